@@ -0,0 +1,263 @@
+package dockerdog
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// Kinds of series.
+const (
+	seriesCount        = "count"
+	seriesGauge        = "gauge"
+	seriesDistribution = "distribution"
+	seriesSet          = "set"
+)
+
+// seriesKey identifies the points that are aggregated into a single point,
+// since APIs keep only the last point for a series at each timestamp.
+type seriesKey struct {
+	kind, name, tags string
+	timestamp        int64
+}
+
+// series is a buffered point of a series.
+type series struct {
+	tags   []string
+	value  float64
+	values []float64
+	set    map[string]bool
+}
+
+// timedEvent is a buffered event, and when it happened, which is zero if it
+// isn't known.
+type timedEvent struct {
+	event *statsd.Event
+	t     time.Time
+}
+
+// timedCheck is a buffered service check, and when it ran, which is zero if
+// it isn't known.
+type timedCheck struct {
+	check *ServiceCheck
+	t     time.Time
+}
+
+// batch is what's buffered between flushes.
+type batch struct {
+	series map[seriesKey]*series
+	events []timedEvent
+	checks []timedCheck
+}
+
+// batchingSink is the part of the Sinks for HTTP APIs that aggregates metrics,
+// and buffers events and service checks, until they're flushed to send
+// every interval, or as soon as batchSize series are buffered, to out.
+type batchingSink struct {
+	out       func(*batch)
+	interval  time.Duration
+	batchSize int
+
+	mu      sync.Mutex
+	pending *batch
+
+	full chan bool
+	done chan bool
+	wg   sync.WaitGroup
+}
+
+// newBatchingSink returns a batchingSink, and starts flushing batches to out.
+func newBatchingSink(interval time.Duration, batchSize int, out func(*batch)) *batchingSink {
+	s := &batchingSink{
+		out:       out,
+		interval:  interval,
+		batchSize: batchSize,
+		pending:   newBatch(),
+		full:      make(chan bool, 1),
+		done:      make(chan bool),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		flushLoop(s.interval, s.full, s.done, s.flush)
+	}()
+	return s
+}
+
+func newBatch() *batch {
+	return &batch{series: make(map[seriesKey]*series)}
+}
+
+// At returns a Sink that reports metrics, events and service checks at t.
+func (s *batchingSink) At(t time.Time) Sink {
+	return &batchingSinkAt{s: s, t: t}
+}
+
+func (s *batchingSink) Count(name string, value int64, tags []string, rate float64) error {
+	return s.At(time.Now()).Count(name, value, tags, rate)
+}
+
+func (s *batchingSink) Gauge(name string, value float64, tags []string, rate float64) error {
+	return s.At(time.Now()).Gauge(name, value, tags, rate)
+}
+
+func (s *batchingSink) Histogram(name string, value float64, tags []string, rate float64) error {
+	return s.At(time.Now()).Histogram(name, value, tags, rate)
+}
+
+func (s *batchingSink) Set(name string, value string, tags []string, rate float64) error {
+	return s.At(time.Now()).Set(name, value, tags, rate)
+}
+
+func (s *batchingSink) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	return s.At(time.Now()).TimeInMilliseconds(name, value, tags, rate)
+}
+
+// Event sends the event, which happened now unless it has a timestamp.
+func (s *batchingSink) Event(e *statsd.Event) error {
+	return s.event(e, e.Timestamp)
+}
+
+// ServiceCheck sends the service check.
+func (s *batchingSink) ServiceCheck(sc *ServiceCheck) error {
+	return s.serviceCheck(sc, sc.Timestamp)
+}
+
+// Close sends anything that's buffered.
+func (s *batchingSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
+
+// record updates the buffered point for a series at t.
+func (s *batchingSink) record(kind, name string, tags []string, t time.Time, update func(*series)) error {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	key := seriesKey{kind: kind, name: name, tags: strings.Join(sorted, ","), timestamp: t.Unix()}
+
+	s.mu.Lock()
+	p, ok := s.pending.series[key]
+	if !ok {
+		p = &series{tags: sorted}
+		if kind == seriesSet {
+			p.set = make(map[string]bool)
+		}
+		s.pending.series[key] = p
+	}
+	update(p)
+	full := len(s.pending.series) >= s.batchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.full <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// event buffers an event that happened at t.
+func (s *batchingSink) event(e *statsd.Event, t time.Time) error {
+	s.mu.Lock()
+	s.pending.events = append(s.pending.events, timedEvent{e, t})
+	s.mu.Unlock()
+	return nil
+}
+
+// serviceCheck buffers a service check that ran at t.
+func (s *batchingSink) serviceCheck(sc *ServiceCheck, t time.Time) error {
+	s.mu.Lock()
+	s.pending.checks = append(s.pending.checks, timedCheck{sc, t})
+	s.mu.Unlock()
+	return nil
+}
+
+// flush sends the buffered batch, if there's anything in it.
+func (s *batchingSink) flush() {
+	s.mu.Lock()
+	b := s.pending
+	s.pending = newBatch()
+	s.mu.Unlock()
+
+	if len(b.series) > 0 || len(b.events) > 0 || len(b.checks) > 0 {
+		s.out(b)
+	}
+}
+
+// batchingSinkAt reports to a batchingSink at a fixed time.
+type batchingSinkAt struct {
+	s *batchingSink
+	t time.Time
+}
+
+func (a *batchingSinkAt) Count(name string, value int64, tags []string, rate float64) error {
+	return a.s.record(seriesCount, name, tags, a.t, func(p *series) { p.value += float64(value) })
+}
+
+func (a *batchingSinkAt) Gauge(name string, value float64, tags []string, rate float64) error {
+	return a.s.record(seriesGauge, name, tags, a.t, func(p *series) { p.value = value })
+}
+
+func (a *batchingSinkAt) Histogram(name string, value float64, tags []string, rate float64) error {
+	return a.s.record(seriesDistribution, name, tags, a.t, func(p *series) { p.values = append(p.values, value) })
+}
+
+func (a *batchingSinkAt) Set(name string, value string, tags []string, rate float64) error {
+	return a.s.record(seriesSet, name, tags, a.t, func(p *series) { p.set[value] = true })
+}
+
+func (a *batchingSinkAt) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	return a.Histogram(name, value, tags, rate)
+}
+
+func (a *batchingSinkAt) Event(e *statsd.Event) error {
+	t := e.Timestamp
+	if t.IsZero() {
+		t = a.t
+	}
+	return a.s.event(e, t)
+}
+
+func (a *batchingSinkAt) ServiceCheck(sc *ServiceCheck) error {
+	t := sc.Timestamp
+	if t.IsZero() {
+		t = a.t
+	}
+	return a.s.serviceCheck(sc, t)
+}
+
+// Close does nothing. The sink that this reports to must be closed instead.
+func (a *batchingSinkAt) Close() error {
+	return nil
+}
+
+// split splits n items into ranges of at most size, and calls f for each.
+func split(n, size int, f func(i, j int)) {
+	for i := 0; i < n; i += size {
+		j := i + size
+		if j > n {
+			j = n
+		}
+		f(i, j)
+	}
+}
+
+// summarize returns the sum, minimum and maximum of a histogram's values.
+func summarize(values []float64) (sum, min, max float64) {
+	min, max = values[0], values[0]
+	for _, v := range values {
+		sum += v
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return sum, min, max
+}
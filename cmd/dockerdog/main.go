@@ -0,0 +1,172 @@
+// Command dockerdog reports Docker events to DogStatsD.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/remind101/dockerdog"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	var (
+		statsdAddr = flag.String("statsd", "localhost:8126", "Address of statsd")
+
+		dockerHost       = flag.String("docker-host", "", "Docker daemon endpoint (defaults to DOCKER_HOST)")
+		dockerContext    = flag.String("docker-context", "", "Docker CLI context to read the daemon endpoint from")
+		dockerTLSCert    = flag.String("docker-tls-cert", "", "Path to the TLS client certificate")
+		dockerTLSKey     = flag.String("docker-tls-key", "", "Path to the TLS client key")
+		dockerTLSCA      = flag.String("docker-tls-ca", "", "Path to the CA used to verify the daemon")
+		dockerAPIVersion = flag.String("docker-api-version", "", "Docker API version to pin requests to")
+		dockerTimeout    = flag.Duration("docker-timeout", 0, "Timeout for connecting to, and requests against, the Docker daemon")
+
+		since = flag.String("since", "", "Report events since this timestamp or relative duration, e.g. 10m")
+		until = flag.String("until", "", "Report events until this timestamp or relative duration, then exit")
+
+		eventsPath  = flag.String("events", "", "Read JSON events from this file, or - for stdin, instead of the Docker daemon")
+		replaySpeed = flag.Float64("replay-speed", 0, "Replay events read with -events at this multiple of their original pace, or as fast as possible when 0")
+
+		shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "Maximum time to spend draining events and flushing metrics on shutdown")
+	)
+	flag.Parse()
+	args := flag.Args()
+	if *eventsPath == "-" && len(args) == 0 {
+		return fmt.Errorf("a config file must be given when reading events from stdin")
+	}
+	var r io.Reader = os.Stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	config, err := dockerdog.LoadConfig(r)
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
+	now := time.Now()
+	sinceTime, err := dockerdog.ParseTimestamp(*since, now)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %v", err)
+	}
+	untilTime, err := dockerdog.ParseTimestamp(*until, now)
+	if err != nil {
+		return fmt.Errorf("invalid -until: %v", err)
+	}
+
+	// Flags take precedence over the config file.
+	for _, f := range []struct {
+		value string
+		field *string
+	}{
+		{*dockerHost, &config.Docker.Host},
+		{*dockerContext, &config.Docker.Context},
+		{*dockerTLSCert, &config.Docker.TLSCert},
+		{*dockerTLSKey, &config.Docker.TLSKey},
+		{*dockerTLSCA, &config.Docker.TLSCA},
+		{*dockerAPIVersion, &config.Docker.APIVersion},
+	} {
+		if f.value != "" {
+			*f.field = f.value
+		}
+	}
+	if *dockerTimeout != 0 {
+		config.Docker.Timeout.Duration = *dockerTimeout
+	}
+
+	opts := []dockerdog.Option{
+		dockerdog.WithSince(sinceTime),
+		dockerdog.WithUntil(untilTime),
+	}
+	if *eventsPath != "" {
+		events := os.Stdin
+		if *eventsPath != "-" {
+			f, err := os.Open(*eventsPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			events = f
+		}
+		opts = append(opts, dockerdog.WithSource(&dockerdog.ReaderSource{
+			Reader: events,
+			Speed:  *replaySpeed,
+			Since:  sinceTime,
+			Until:  untilTime,
+		}))
+	}
+
+	var sink dockerdog.Sink
+	if config.Sink != nil {
+		sink, err = dockerdog.NewSink(*config.Sink)
+		if err != nil {
+			return fmt.Errorf("error configuring sink: %v", err)
+		}
+	} else {
+		sink, err = dockerdog.NewStatsdSink(*statsdAddr)
+		if err != nil {
+			return fmt.Errorf("could not connect to statsd: %v", err)
+		}
+	}
+	if len(config.Routes) > 0 {
+		router, err := dockerdog.NewRouter(sink, config.Routes)
+		if err != nil {
+			sink.Close()
+			return fmt.Errorf("error configuring routes: %v", err)
+		}
+		sink = router
+	}
+
+	w, err := dockerdog.NewWatcher(config, sink, opts...)
+	if err != nil {
+		sink.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleSignals(cancel, *shutdownTimeout)
+
+	err = w.Run(ctx)
+	if cerr := sink.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("error flushing metrics: %v", cerr)
+	}
+	return err
+}
+
+// handleSignals cancels the context when SIGINT or SIGTERM is received, so
+// that dockerdog can drain in-flight events and flush metrics before exiting.
+// If shutdown doesn't complete within timeout, or a second signal is received,
+// the process exits immediately with a non-zero status.
+func handleSignals(cancel func(), timeout time.Duration) {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-c
+	log.Printf("received %s, shutting down", sig)
+	cancel()
+
+	select {
+	case sig = <-c:
+		log.Fatalf("received %s, exiting without flushing metrics", sig)
+	case <-time.After(timeout):
+		log.Fatalf("shutdown did not complete within %v", timeout)
+	}
+}
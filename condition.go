@@ -0,0 +1,152 @@
+package dockerdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operators that can be used in conditions.
+const (
+	opEqual    = "=="
+	opNotEqual = "!="
+	opMatch    = "=~"
+	opNotMatch = "!~"
+	opIn       = "in"
+	opNotIn    = "not in"
+)
+
+// conditionExpr matches a condition expression, like `exitCode != "0"`.
+var conditionExpr = regexp.MustCompile(`^\s*([^\s=!~]+)\s*(==|!=|=~|!~|not\s+in\b|in\b)\s*(.*?)\s*$`)
+
+// Condition is a condition on the value of an event attribute, parsed from an
+// expression like `exitCode != "0"`, `signal in ["9", "15"]` or
+// `image =~ ^registry.internal/`. Attributes that aren't set have an empty
+// value.
+type Condition struct {
+	Attribute string
+	Op        string
+
+	// Values are compared with the attribute for ==, !=, in and not in.
+	Values []string
+
+	// Regexp is matched against the attribute for =~ and !~.
+	Regexp *regexp.Regexp
+}
+
+// ParseCondition parses a condition expression. Values can be quoted as JSON
+// strings, and must be quoted if they contain spaces. The values for in and
+// not in are a JSON array.
+func ParseCondition(s string) (Condition, error) {
+	m := conditionExpr.FindStringSubmatch(s)
+	if m == nil {
+		return Condition{}, fmt.Errorf("invalid condition %q", s)
+	}
+
+	c := Condition{
+		Attribute: m[1],
+		Op:        strings.Join(strings.Fields(m[2]), " "),
+	}
+	raw := m[3]
+
+	switch c.Op {
+	case opIn, opNotIn:
+		var values []json.Number
+		d := json.NewDecoder(strings.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&values); err != nil {
+			return Condition{}, fmt.Errorf("invalid condition %q: %s expects a JSON array: %v", s, c.Op, err)
+		}
+		for _, v := range values {
+			c.Values = append(c.Values, string(v))
+		}
+	case opMatch, opNotMatch:
+		v, err := conditionValue(raw)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+		}
+		c.Regexp, err = regexp.Compile(v)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+		}
+	default:
+		v, err := conditionValue(raw)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+		}
+		c.Values = []string{v}
+	}
+
+	return c, nil
+}
+
+// conditionValue returns a single value, which may be quoted.
+func conditionValue(raw string) (string, error) {
+	if !strings.HasPrefix(raw, `"`) {
+		if raw == "" || strings.ContainsAny(raw, " \t") {
+			return "", fmt.Errorf("expected a single value, got %q", raw)
+		}
+		return raw, nil
+	}
+	var v string
+	err := json.Unmarshal([]byte(raw), &v)
+	return v, err
+}
+
+func (c *Condition) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := ParseCondition(s)
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+// Match returns true if the attributes satisfy the condition.
+func (c Condition) Match(attributes map[string]string) bool {
+	v := attributes[c.Attribute]
+	switch c.Op {
+	case opMatch:
+		return c.Regexp.MatchString(v)
+	case opNotMatch:
+		return !c.Regexp.MatchString(v)
+	case opEqual, opIn:
+		return contains(c.Values, v)
+	case opNotEqual, opNotIn:
+		return !contains(c.Values, v)
+	}
+	return false
+}
+
+// Rule adds tags to events whose attributes match all of its conditions.
+type Rule struct {
+	When []Condition `json:"when"`
+
+	// Tags maps the names of the tags to add to their values, e.g.
+	// {"exit": "error"}.
+	Tags map[string]string `json:"tags"`
+}
+
+// matchAll returns true if the attributes satisfy all of the conditions.
+func matchAll(conditions []Condition, attributes map[string]string) bool {
+	for _, c := range conditions {
+		if !c.Match(attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		expr       string
+		attributes map[string]string
+		match      bool
+	}{
+		{`exitCode != "0"`, map[string]string{"exitCode": "137"}, true},
+		{`exitCode != 0`, map[string]string{"exitCode": "0"}, false},
+		{`exitCode!=0`, map[string]string{}, true},
+		{`name == "my app"`, map[string]string{"name": "my app"}, true},
+		{`signal in ["9", "15"]`, map[string]string{"signal": "15"}, true},
+		{`signal in [9, 15]`, map[string]string{"signal": "9"}, true},
+		{`signal in ["9", "15"]`, map[string]string{"signal": "2"}, false},
+		{`signal not in ["9", "15"]`, map[string]string{"signal": "2"}, true},
+		{`image =~ ^registry.internal/`, map[string]string{"image": "registry.internal/api:1"}, true},
+		{`image =~ "^registry.internal/"`, map[string]string{"image": "nginx"}, false},
+		{`image !~ ^registry.internal/`, map[string]string{"image": "nginx"}, true},
+		{`com.docker.compose.service == web`, map[string]string{"com.docker.compose.service": "web"}, true},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCondition(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			assert.Equal(t, tt.match, c.Match(tt.attributes), tt.expr)
+		}
+	}
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		`exitCode`,
+		`exitCode > 0`,
+		`exitCode ==`,
+		`name == my app`,
+		`signal in 9`,
+		`image =~ (`,
+	} {
+		_, err := ParseCondition(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestReporter_Conditions(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "events": {
+    "container": {
+      "actions": {
+        "die": {
+          "when": ["exitCode != 0"],
+          "rules": [
+            {"when": ["exitCode in [137, 143]"], "tags": {"reason": "killed"}}
+          ]
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	r := newReporter(config, s)
+	for _, code := range []string{"0", "1", "137"} {
+		r.Process(&docker.APIEvents{Type: "container", Action: "die", Actor: docker.APIActor{Attributes: map[string]string{"exitCode": code}}})
+	}
+
+	assert.Equal(t, []string{
+		"docker.events.container.die:1|c",
+		"docker.events.container.die:1|c|#reason:killed",
+	}, packets(2))
+
+	_, err = LoadConfig(strings.NewReader(`{"events": {"container": {"actions": {"die": {"when": ["exitCode >= 1"]}}}}}`))
+	assert.Error(t, err)
+}
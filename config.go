@@ -0,0 +1,294 @@
+package dockerdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// Config represents a config file that controls what events and actions to
+// track.
+type Config struct {
+	// Docker configures the connection to the Docker daemon.
+	Docker DockerConfig `json:"docker"`
+
+	// CrashLoop enables crash loop detection when present.
+	CrashLoop *CrashLoopConfig `json:"crash_loop"`
+
+	// ServiceChecks enables DogStatsD service checks when present.
+	ServiceChecks *ServiceChecksConfig `json:"service_checks"`
+
+	// Daemon enables periodically reporting metrics about the health of
+	// the Docker daemon when present.
+	Daemon *DaemonConfig `json:"daemon"`
+
+	// Inventory enables periodically reporting gauges for the images,
+	// containers and volumes on the host when present.
+	Inventory *InventoryConfig `json:"inventory"`
+
+	// Stats enables collecting resource stats for running containers when
+	// present.
+	Stats *StatsConfig `json:"stats"`
+
+	// Queue enables queueing events between the event source and the
+	// processors when present. Otherwise, events are processed as they're
+	// received.
+	Queue *QueueConfig `json:"queue"`
+
+	// Watchdog configures detecting, and recovering from, stalled event
+	// streams.
+	Watchdog WatchdogConfig `json:"watchdog"`
+
+	// Filters are passed to the Docker daemon to filter the events that
+	// it sends, e.g. {"label": ["com.example.team=payments"]}. See
+	// `docker events --filter`.
+	Filters map[string][]string `json:"filters"`
+
+	// Include and Exclude filter container events by the container's
+	// image, name or labels. Excluded events are dropped, before they're
+	// reported or seen by any other feature, except audit logs, which
+	// record every event.
+	Include *FilterConfig `json:"include"`
+	Exclude *FilterConfig `json:"exclude"`
+
+	// Labels enables containers to control how they're reported with
+	// labels when present.
+	Labels *LabelsConfig `json:"labels"`
+
+	// Presets includes the well-known labels of orchestrators, like
+	// "compose" or "kubernetes", across all events and actions. See
+	// presets.
+	Presets []string `json:"presets"`
+
+	// Tags renames attributes when they're reported as tags, e.g.
+	// {"com.example.team": "team"}.
+	Tags map[string]string `json:"tags"`
+
+	// Attributes defines any global attributes to include across all events
+	// and actions.
+	Attributes map[string]bool `json:"attributes"`
+
+	// Sink replaces the default sink, which sends to DogStatsD at the
+	// -statsd address.
+	Sink *SinkConfig `json:"sink"`
+
+	// Routes send the metrics whose tags match their conditions to other
+	// sinks, instead of the default one.
+	Routes []RouteConfig `json:"routes"`
+
+	// Webhooks POST the events that are reported, with the tags that
+	// they're counted with, to HTTP endpoints.
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// Traces enables exporting the lifecycle of each container as a trace
+	// when present.
+	Traces *TracesConfig `json:"traces"`
+
+	// Syslog and Journald write a record of the events that are reported
+	// to syslog and the systemd journal, as an audit trail.
+	Syslog   []SyslogConfig  `json:"syslog"`
+	Journald *JournaldConfig `json:"journald"`
+
+	// Metrics configures custom metrics, in addition to the counters for
+	// events.
+	Metrics []MetricConfig `json:"metrics"`
+
+	// Events configures the events that should be tracked.
+	Events map[string]struct {
+		// Actions configures the actions that should be tracked.
+		Actions map[string]struct {
+			// Attributes configures the attributes in the action
+			// that should be included.
+			Attributes map[string]bool `json:"attributes"`
+
+			// Payload configures reporting the payload of the
+			// action as a tag. Payloads aren't reported unless
+			// configured.
+			Payload *PayloadConfig `json:"payload"`
+
+			// When restricts the action to events whose
+			// attributes match all of the conditions, e.g.
+			// ["exitCode != 0"]. Other events aren't counted.
+			When []Condition `json:"when"`
+
+			// Rules add tags to events that match their
+			// conditions.
+			Rules []Rule `json:"rules"`
+
+			// Include and Exclude filter container events
+			// for the action, in addition to the global
+			// filters.
+			Include *FilterConfig `json:"include"`
+			Exclude *FilterConfig `json:"exclude"`
+		} `json:"actions"`
+	} `json:"events"`
+}
+
+// attributes returns a map of the attributes that should be included for a
+// given action.
+func (c *Config) attributes(event, action string) map[string]bool {
+	attributes := make(map[string]bool)
+	for _, name := range c.Presets {
+		for k := range presets[name] {
+			attributes[k] = true
+		}
+	}
+	for k, v := range c.Attributes {
+		attributes[k] = v
+	}
+	if e, ok := c.Events[event]; ok {
+		if a, ok := e.Actions[action]; ok {
+			for k, v := range a.Attributes {
+				attributes[k] = v
+			}
+		}
+	}
+	return attributes
+}
+
+// statsAttributes returns a map of the attributes that container stats
+// should be tagged with.
+func (c *Config) statsAttributes() map[string]bool {
+	attributes := c.attributes("", "")
+	if c.Stats != nil {
+		for k, v := range c.Stats.Attributes {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+// tag returns the name of the tag that an attribute is reported as.
+func (c *Config) tag(attribute string) string {
+	if name, ok := c.Tags[attribute]; ok {
+		return name
+	}
+	for _, name := range c.Presets {
+		if tag, ok := presets[name][attribute]; ok {
+			return tag
+		}
+	}
+	return attribute
+}
+
+// payload returns the payload config for a given action, or nil if the payload
+// shouldn't be reported.
+func (c *Config) payload(event, action string) *PayloadConfig {
+	if e, ok := c.Events[event]; ok {
+		if a, ok := e.Actions[action]; ok {
+			return a.Payload
+		}
+	}
+	return nil
+}
+
+// conditions returns the conditions that events must match for a given
+// action to be counted.
+func (c *Config) conditions(event, action string) []Condition {
+	if e, ok := c.Events[event]; ok {
+		if a, ok := e.Actions[action]; ok {
+			return a.When
+		}
+	}
+	return nil
+}
+
+// actionFilters returns the include and exclude filters for a given action.
+func (c *Config) actionFilters(event, action string) (include, exclude *FilterConfig) {
+	if e, ok := c.Events[event]; ok {
+		if a, ok := e.Actions[action]; ok {
+			return a.Include, a.Exclude
+		}
+	}
+	return nil, nil
+}
+
+// rules returns the rules for a given action.
+func (c *Config) rules(event, action string) []Rule {
+	if e, ok := c.Events[event]; ok {
+		if a, ok := e.Actions[action]; ok {
+			return a.Rules
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration that can be unmarshalled from a JSON string
+// such as "30s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Pattern is a regular expression that can be unmarshalled from a JSON
+// string.
+type Pattern struct {
+	*regexp.Regexp
+}
+
+func (p *Pattern) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	p.Regexp = re
+	return nil
+}
+
+// LoadConfig parses the given json config file in r and returns a parsed
+// config.
+func LoadConfig(r io.Reader) (*Config, error) {
+	var c Config
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return &c, err
+	}
+	for _, name := range c.Presets {
+		if _, ok := presets[name]; !ok {
+			return &c, fmt.Errorf("unknown preset %q", name)
+		}
+	}
+	if c.Queue != nil {
+		if err := c.Queue.validate(); err != nil {
+			return &c, err
+		}
+	}
+	for i := range c.Metrics {
+		if err := c.Metrics[i].validate(); err != nil {
+			return &c, err
+		}
+	}
+	for i := range c.Webhooks {
+		if err := c.Webhooks[i].validate(); err != nil {
+			return &c, err
+		}
+	}
+	for i := range c.Syslog {
+		if err := c.Syslog[i].validate(); err != nil {
+			return &c, err
+		}
+	}
+	if c.Journald != nil {
+		if err := c.Journald.validate(); err != nil {
+			return &c, err
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,92 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Attributes(t *testing.T) {
+	config := testConfig(t)
+
+	assert.Equal(t, map[string]bool{"image": true}, config.attributes("container", "start"))
+	assert.Equal(t, map[string]bool{"image": false}, config.attributes("container", "create"))
+	assert.Equal(t, map[string]bool{"image": true, "exitCode": true}, config.attributes("container", "die"))
+	assert.Equal(t, map[string]bool{"image": true, "signal": true}, config.attributes("container", "kill"))
+}
+
+func TestConfig_Presets(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "presets": ["compose"],
+  "tags": {
+    "com.docker.compose.project": "project"
+  },
+  "events": {
+    "container": {
+      "actions": {
+        "start": {},
+        "die": {
+          "attributes": {
+            "com.docker.compose.service": false
+          }
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string]bool{"com.docker.compose.project": true, "com.docker.compose.service": true}, config.attributes("container", "start"))
+	assert.Equal(t, map[string]bool{"com.docker.compose.project": true, "com.docker.compose.service": false}, config.attributes("container", "die"))
+	assert.Equal(t, "project", config.tag("com.docker.compose.project"))
+	assert.Equal(t, "compose_service", config.tag("com.docker.compose.service"))
+	assert.Equal(t, "image", config.tag("image"))
+
+	_, err = LoadConfig(strings.NewReader(`{"presets": ["mesos"]}`))
+	assert.EqualError(t, err, `unknown preset "mesos"`)
+}
+
+const testConfigJson = `{
+  "attributes": {
+    "image": true
+  },
+  "events": {
+    "image": {
+      "actions": {
+        "pull": {},
+        "delete": {}
+      }
+    },
+    "container": {
+      "actions": {
+        "create": {
+          "attributes": {
+            "image": false
+          }
+	},
+        "start": {},
+        "die": {
+          "attributes": {
+            "exitCode": true
+          }
+        },
+        "kill": {
+          "attributes": {
+            "signal": true
+          }
+        }
+      }
+    }
+  }
+}`
+
+func testConfig(t testing.TB) *Config {
+	config, err := LoadConfig(strings.NewReader(testConfigJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
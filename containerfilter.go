@@ -0,0 +1,169 @@
+package dockerdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Matcher matches strings with a glob, like "k8s.gcr.io/pause*", or a regular
+// expression between slashes, like "/^datadog\/agent(:|$)/". Globs match the
+// whole string, and * and ? match any characters, including slashes.
+type Matcher struct {
+	*regexp.Regexp
+}
+
+// ParseMatcher parses a glob or regular expression.
+func ParseMatcher(s string) (Matcher, error) {
+	var expr string
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		expr = s[1 : len(s)-1]
+	} else {
+		expr = globExpr(s)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Matcher{}, fmt.Errorf("invalid pattern %q: %v", s, err)
+	}
+	return Matcher{re}, nil
+}
+
+// globExpr returns the regular expression for a glob.
+func globExpr(glob string) string {
+	var b bytes.Buffer
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func (m *Matcher) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := ParseMatcher(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// LabelMatcher matches containers by label, from "key", which matches any
+// container with the label, or "key=value", where value is a Matcher.
+type LabelMatcher struct {
+	Key   string
+	Value *Matcher
+}
+
+func (m *LabelMatcher) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	i := strings.Index(s, "=")
+	if i < 0 {
+		*m = LabelMatcher{Key: s}
+		return nil
+	}
+	v, err := ParseMatcher(s[i+1:])
+	if err != nil {
+		return err
+	}
+	*m = LabelMatcher{Key: s[:i], Value: &v}
+	return nil
+}
+
+// match returns true if the attributes have the label, with a matching
+// value.
+func (m *LabelMatcher) match(attributes map[string]string) bool {
+	v, ok := attributes[m.Key]
+	return ok && (m.Value == nil || m.Value.MatchString(v))
+}
+
+// FilterConfig matches container events by the container's image, name or
+// labels, or the event's payload. An event matches if any of them match.
+type FilterConfig struct {
+	Image   []Matcher      `json:"image"`
+	Name    []Matcher      `json:"name"`
+	Label   []LabelMatcher `json:"label"`
+	Payload []Matcher      `json:"payload"`
+}
+
+// match returns true if the event matches the filter.
+func (f *FilterConfig) match(event *docker.APIEvents) bool {
+	_, payload := splitAction(event.Action)
+	for _, m := range []struct {
+		matchers []Matcher
+		value    string
+	}{
+		{f.Image, event.Actor.Attributes["image"]},
+		{f.Name, event.Actor.Attributes["name"]},
+		{f.Payload, payload},
+	} {
+		for _, matcher := range m.matchers {
+			if matcher.MatchString(m.value) {
+				return true
+			}
+		}
+	}
+	for i := range f.Label {
+		if f.Label[i].match(event.Actor.Attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if the event matches include, when set, and doesn't
+// match exclude, when set.
+func allowed(event *docker.APIEvents, include, exclude *FilterConfig) bool {
+	if include != nil && !include.match(event) {
+		return false
+	}
+	return exclude == nil || !exclude.match(event)
+}
+
+// containerFilter drops container events that are excluded by the global
+// include and exclude filters.
+type containerFilter struct {
+	config *Config
+}
+
+// Process drops the event if it's excluded.
+func (f *containerFilter) Process(event *docker.APIEvents) bool {
+	if event.Type != "container" {
+		return true
+	}
+	return allowed(event, f.config.Include, f.config.Exclude)
+}
+
+// actionFilter drops container events that are excluded by the include and
+// exclude filters of their action.
+type actionFilter struct {
+	config *Config
+}
+
+// Process drops the event if it's excluded.
+func (f *actionFilter) Process(event *docker.APIEvents) bool {
+	if event.Type != "container" {
+		return true
+	}
+	action, _ := splitAction(event.Action)
+	include, exclude := f.config.actionFilters(event.Type, action)
+	return allowed(event, include, exclude)
+}
@@ -0,0 +1,94 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{"k8s.gcr.io/pause*", "k8s.gcr.io/pause:3.1", true},
+		{"k8s.gcr.io/pause*", "k8s.gcr.io/pause-amd64:3.1", true},
+		{"k8s.gcr.io/pause*", "mirror/k8s.gcr.io/pause:3.1", false},
+		{"k8sXgcr.io/pause", "k8s.gcr.io/pause", false},
+		{"web-?", "web-1", true},
+		{"web-?", "web-10", false},
+		{`/^datadog\/agent(:|$)/`, "datadog/agent:7", true},
+		{`/^datadog\/agent(:|$)/`, "datadog/agent-dev", false},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.pattern)
+		if assert.NoError(t, err, tt.pattern) {
+			assert.Equal(t, tt.match, m.MatchString(tt.value), "%s %s", tt.pattern, tt.value)
+		}
+	}
+
+	_, err := ParseMatcher("/(/")
+	assert.Error(t, err)
+}
+
+func TestContainerFilter(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "exclude": {
+    "image": ["k8s.gcr.io/pause*", "/^datadog\\/agent/"],
+    "name": ["dockerdog"],
+    "label": ["com.example.infra", "team=platform-*"]
+  },
+  "events": {
+    "container": {
+      "actions": {
+        "exec_start": {
+          "exclude": {
+            "payload": ["/bin/sh -c curl -f *"]
+          }
+        },
+        "start": {
+          "include": {
+            "image": ["registry.internal/*"]
+          }
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := ProcessorFunc(func(event *docker.APIEvents) bool {
+		return (&containerFilter{config: config}).Process(event) && (&actionFilter{config: config}).Process(event)
+	})
+
+	event := func(action string, attributes map[string]string) *docker.APIEvents {
+		return &docker.APIEvents{Type: "container", Action: action, Actor: docker.APIActor{Attributes: attributes}}
+	}
+
+	assert.False(t, f.Process(event("die", map[string]string{"image": "k8s.gcr.io/pause:3.1"})))
+	assert.False(t, f.Process(event("die", map[string]string{"image": "datadog/agent:7"})))
+	assert.False(t, f.Process(event("die", map[string]string{"name": "dockerdog"})))
+	assert.False(t, f.Process(event("die", map[string]string{"com.example.infra": ""})))
+	assert.False(t, f.Process(event("die", map[string]string{"team": "platform-tools"})))
+	assert.True(t, f.Process(event("die", map[string]string{"image": "nginx", "team": "payments"})))
+
+	assert.False(t, f.Process(event("exec_start: /bin/sh -c curl -f http://localhost/", map[string]string{"image": "nginx"})))
+	assert.True(t, f.Process(event("exec_start: bash", map[string]string{"image": "nginx"})))
+
+	assert.False(t, f.Process(event("start", map[string]string{"image": "nginx"})))
+	assert.True(t, f.Process(event("start", map[string]string{"image": "registry.internal/api:1"})))
+
+	// The global filters don't apply the filters of actions.
+	assert.True(t, (&containerFilter{config: config}).Process(event("start", map[string]string{"image": "nginx"})))
+
+	// Filters only apply to container events.
+	assert.True(t, f.Process(&docker.APIEvents{Type: "image", Action: "pull", Actor: docker.APIActor{Attributes: map[string]string{"name": "dockerdog"}}}))
+
+	_, err = LoadConfig(strings.NewReader(`{"exclude": {"image": ["/(/"]}}`))
+	assert.Error(t, err)
+}
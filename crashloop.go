@@ -0,0 +1,144 @@
+package dockerdog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// defaultCrashLoopRestarts and defaultCrashLoopWindow are used when
+	// the crash_loop config omits restarts or window.
+	defaultCrashLoopRestarts = 5
+	defaultCrashLoopWindow   = 10 * time.Minute
+
+	// crashLoopInterval is how often crash loops are expired and the
+	// docker.crash_loop.active gauge is reported.
+	crashLoopInterval = 10 * time.Second
+)
+
+// CrashLoopConfig configures crash loop detection. A service is considered
+// to be crash looping when its containers die more than Restarts times within
+// Window.
+type CrashLoopConfig struct {
+	// Label is the container label that identifies a service across
+	// container restarts, e.g. "com.docker.compose.service". Container IDs
+	// change when a container is recreated, so containers are identified
+	// by name when this is empty, or the label is missing.
+	Label string `json:"label"`
+
+	// Restarts is the number of times a service can die within Window
+	// before it's considered to be crash looping.
+	Restarts int `json:"restarts"`
+
+	// Window is the period over which deaths are counted.
+	Window Duration `json:"window"`
+
+	// Event enables sending a Datadog event when a service starts crash
+	// looping.
+	Event bool `json:"event"`
+}
+
+// crashLoopDetector tracks container deaths by service to detect crash
+// loops.
+type crashLoopDetector struct {
+	label    string
+	restarts int
+	window   time.Duration
+
+	// mu guards deaths and looping, since events are observed
+	// concurrently by queue workers.
+	mu sync.Mutex
+
+	// deaths holds the times that each service died within the window.
+	deaths map[string][]time.Time
+
+	// looping holds the services that are currently crash looping.
+	looping map[string]bool
+}
+
+func newCrashLoopDetector(c CrashLoopConfig) *crashLoopDetector {
+	d := &crashLoopDetector{
+		label:    c.Label,
+		restarts: c.Restarts,
+		window:   c.Window.Duration,
+		deaths:   make(map[string][]time.Time),
+		looping:  make(map[string]bool),
+	}
+	if d.restarts <= 0 {
+		d.restarts = defaultCrashLoopRestarts
+	}
+	if d.window <= 0 {
+		d.window = defaultCrashLoopWindow
+	}
+	return d
+}
+
+// observe records the event if it's a container dying. It returns the
+// service and true if the service has just started crash looping.
+func (d *crashLoopDetector) observe(event *docker.APIEvents) (string, bool) {
+	if event.Type != "container" || event.Action != "die" {
+		return "", false
+	}
+
+	service := event.Actor.Attributes[d.label]
+	if d.label == "" || service == "" {
+		service = event.Actor.Attributes["name"]
+	}
+	if service == "" {
+		return "", false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := eventTime(event)
+	deaths := append(d.deaths[service], t)
+	deaths = d.prune(deaths, t)
+	d.deaths[service] = deaths
+
+	if len(deaths) > d.restarts && !d.looping[service] {
+		d.looping[service] = true
+		return service, true
+	}
+	return service, false
+}
+
+// expire forgets deaths that fall outside of the window, and returns the
+// number of services that are still crash looping.
+func (d *crashLoopDetector) expire(now time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for service, deaths := range d.deaths {
+		deaths = d.prune(deaths, now)
+		if len(deaths) == 0 {
+			delete(d.deaths, service)
+		} else {
+			d.deaths[service] = deaths
+		}
+		if len(deaths) <= d.restarts {
+			delete(d.looping, service)
+		}
+	}
+	return len(d.looping)
+}
+
+// prune removes the deaths that happened more than the window before now.
+func (d *crashLoopDetector) prune(deaths []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-d.window)
+	i := 0
+	for i < len(deaths) && !deaths[i].After(cutoff) {
+		i++
+	}
+	return deaths[i:]
+}
+
+// eventTime returns the time that the event happened.
+func eventTime(event *docker.APIEvents) time.Time {
+	if event.TimeNano != 0 {
+		return time.Unix(0, event.TimeNano)
+	}
+	return time.Unix(event.Time, 0)
+}
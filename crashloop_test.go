@@ -0,0 +1,54 @@
+package dockerdog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrashLoopDetector(t *testing.T) {
+	d := newCrashLoopDetector(CrashLoopConfig{
+		Label:    "com.docker.compose.service",
+		Restarts: 2,
+		Window:   Duration{time.Minute},
+	})
+
+	now := time.Unix(1000, 0)
+	die := func(at time.Time, attributes map[string]string) (string, bool) {
+		return d.observe(&docker.APIEvents{
+			Type:     "container",
+			Action:   "die",
+			TimeNano: at.UnixNano(),
+			Actor:    docker.APIActor{Attributes: attributes},
+		})
+	}
+	web := map[string]string{"name": "app_web_1", "com.docker.compose.service": "web"}
+
+	_, looping := die(now, web)
+	assert.False(t, looping)
+	_, looping = die(now.Add(10*time.Second), web)
+	assert.False(t, looping)
+
+	// Containers without the label fall back to their name.
+	service, looping := die(now.Add(10*time.Second), map[string]string{"name": "worker"})
+	assert.Equal(t, "worker", service)
+	assert.False(t, looping)
+
+	service, looping = die(now.Add(20*time.Second), web)
+	assert.Equal(t, "web", service)
+	assert.True(t, looping)
+
+	// Only reported once while the service is crash looping.
+	_, looping = die(now.Add(30*time.Second), web)
+	assert.False(t, looping)
+	assert.Equal(t, 1, d.expire(now.Add(30*time.Second)))
+
+	// Other actions are ignored.
+	_, looping = d.observe(&docker.APIEvents{Type: "container", Action: "start", Actor: docker.APIActor{Attributes: web}})
+	assert.False(t, looping)
+
+	assert.Equal(t, 0, d.expire(now.Add(2*time.Minute)))
+	assert.Empty(t, d.deaths)
+}
@@ -0,0 +1,111 @@
+package dockerdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// defaultDaemonInterval is how often the daemon is polled, when not
+// configured.
+const defaultDaemonInterval = 15 * time.Second
+
+// DaemonConfig configures polling the Docker daemon for information about
+// its health.
+type DaemonConfig struct {
+	// Interval is how often the daemon is polled.
+	Interval Duration `json:"interval"`
+}
+
+// daemonCollector periodically reports metrics from `docker info`, and how
+// long the daemon takes to respond, to a Sink. Requests that take longer than
+// the interval time out, and count as errors.
+type daemonCollector struct {
+	api      *daemonAPI
+	sink     Sink
+	interval time.Duration
+}
+
+func newDaemonCollector(api *daemonAPI, s Sink, config DaemonConfig) *daemonCollector {
+	interval := config.Interval.Duration
+	if interval <= 0 {
+		interval = defaultDaemonInterval
+	}
+	return &daemonCollector{
+		api:      api,
+		sink:     s,
+		interval: interval,
+	}
+}
+
+// run polls the daemon every interval until ctx is cancelled.
+func (c *daemonCollector) run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		c.collect(ctx)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collect pings the daemon, and reports its info.
+func (c *daemonCollector) collect(ctx context.Context) {
+	c.time("ping", func() error {
+		ctx, cancel := context.WithTimeout(ctx, c.interval)
+		defer cancel()
+		return c.api.ping(ctx)
+	})
+
+	info := new(docker.DockerInfo)
+	err := c.time("info", func() error {
+		ctx, cancel := context.WithTimeout(ctx, c.interval)
+		defer cancel()
+		return c.api.getJSON(ctx, "/info", nil, info)
+	})
+	if err != nil {
+		log.Printf("error getting Docker daemon info: %v", err)
+		return
+	}
+
+	reportDaemonInfo(c.sink, info)
+}
+
+// time reports how long f takes, in milliseconds, to the docker.daemon.latency
+// histogram, and increments docker.daemon.errors if it fails.
+func (c *daemonCollector) time(endpoint string, f func() error) error {
+	tags := []string{fmt.Sprintf("endpoint:%s", endpoint)}
+
+	start := time.Now()
+	err := f()
+	c.sink.Histogram("docker.daemon.latency", float64(time.Since(start))/float64(time.Millisecond), tags, 1)
+
+	if err != nil {
+		c.sink.Count("docker.daemon.errors", 1, tags, 1)
+	}
+	return err
+}
+
+// reportDaemonInfo reports gauges from `docker info`.
+func reportDaemonInfo(s Sink, info *docker.DockerInfo) {
+	var tags []string
+	if info.ServerVersion != "" {
+		tags = append(tags, fmt.Sprintf("docker_version:%s", info.ServerVersion))
+	}
+
+	s.Gauge("docker.daemon.containers.running", float64(info.ContainersRunning), tags, 1)
+	s.Gauge("docker.daemon.containers.paused", float64(info.ContainersPaused), tags, 1)
+	s.Gauge("docker.daemon.containers.stopped", float64(info.ContainersStopped), tags, 1)
+	s.Gauge("docker.daemon.images", float64(info.Images), tags, 1)
+	s.Gauge("docker.daemon.goroutines", float64(info.NGoroutines), tags, 1)
+	s.Gauge("docker.daemon.fds", float64(info.NFd), tags, 1)
+	s.Gauge("docker.daemon.event_listeners", float64(info.NEventsListener), tags, 1)
+}
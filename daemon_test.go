@@ -0,0 +1,66 @@
+package dockerdog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportDaemonInfo(t *testing.T) {
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	reportDaemonInfo(s, &docker.DockerInfo{
+		ContainersRunning: 3,
+		ContainersStopped: 1,
+		Images:            10,
+		NGoroutines:       120,
+		NFd:               64,
+		NEventsListener:   2,
+		ServerVersion:     "1.12.1",
+	})
+
+	assert.Equal(t, []string{
+		"docker.daemon.containers.paused:0.000000|g|#docker_version:1.12.1",
+		"docker.daemon.containers.running:3.000000|g|#docker_version:1.12.1",
+		"docker.daemon.containers.stopped:1.000000|g|#docker_version:1.12.1",
+		"docker.daemon.event_listeners:2.000000|g|#docker_version:1.12.1",
+		"docker.daemon.fds:64.000000|g|#docker_version:1.12.1",
+		"docker.daemon.goroutines:120.000000|g|#docker_version:1.12.1",
+		"docker.daemon.images:10.000000|g|#docker_version:1.12.1",
+	}, packets(7))
+}
+
+func TestDaemonCollector_Hung(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer daemon.Close()
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	c := newDaemonCollector(newTestEventStream(t, daemon.URL, nil).api, s, DaemonConfig{Interval: Duration{50 * time.Millisecond}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		c.run(ctx)
+		close(done)
+	}()
+
+	// Requests time out after the interval, and count as errors.
+	got := packets(4)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("collector didn't stop")
+	}
+	assert.Contains(t, got, "docker.daemon.errors:1|c|#endpoint:ping")
+	assert.Contains(t, got, "docker.daemon.errors:1|c|#endpoint:info")
+}
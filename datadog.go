@@ -0,0 +1,234 @@
+package dockerdog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDatadogURL           = "https://api.datadoghq.com"
+	defaultDatadogAPIKeyEnv     = "DD_API_KEY"
+	defaultDatadogFlushInterval = 10 * time.Second
+	defaultDatadogBatchSize     = 1000
+)
+
+// DatadogConfig configures sending metrics, events and service checks
+// directly to the Datadog HTTP API, without an agent.
+type DatadogConfig struct {
+	// URL is the base URL of the API, e.g. "https://api.datadoghq.eu".
+	URL string `json:"url"`
+
+	// APIKeyFile is a file to read the API key from. Otherwise, it's read
+	// from the environment variable named by APIKeyEnv, DD_API_KEY by
+	// default.
+	APIKeyFile string `json:"api_key_file"`
+	APIKeyEnv  string `json:"api_key_env"`
+
+	// Host is the host that metrics are reported for. Defaults to the
+	// hostname.
+	Host string `json:"host"`
+
+	HTTPExportConfig
+}
+
+// apiKey returns the API key.
+func (c *DatadogConfig) apiKey() (string, error) {
+	env := c.APIKeyEnv
+	if env == "" {
+		env = defaultDatadogAPIKeyEnv
+	}
+	return readSecret("Datadog API key", c.APIKeyFile, env)
+}
+
+// datadogSeries is a series in the body of /api/v1/series and
+// /api/v1/distribution_points.
+type datadogSeries struct {
+	Metric   string        `json:"metric"`
+	Points   []interface{} `json:"points"`
+	Type     string        `json:"type,omitempty"`
+	Interval int64         `json:"interval,omitempty"`
+	Host     string        `json:"host,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+}
+
+// datadogEvent is the body of /api/v1/events.
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	Priority       string   `json:"priority,omitempty"`
+	SourceTypeName string   `json:"source_type_name,omitempty"`
+	AlertType      string   `json:"alert_type,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// datadogCheck is a service check in the body of /api/v1/check_run.
+type datadogCheck struct {
+	Check     string   `json:"check"`
+	HostName  string   `json:"host_name"`
+	Status    int      `json:"status"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// DatadogSink is a Sink that sends to the Datadog HTTP API. Metrics are
+// aggregated, and sent in gzipped batches every flush interval.
+type DatadogSink struct {
+	*batchingSink
+	client  *retryingClient
+	url     string
+	headers headerTemplates
+	apiKey  string
+	host    string
+}
+
+// NewDatadogSink returns a DatadogSink, and starts flushing metrics.
+func NewDatadogSink(c DatadogConfig) (*DatadogSink, error) {
+	key, err := c.apiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := parseHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	e := c.HTTPExportConfig.defaults(defaultDatadogFlushInterval, defaultDatadogBatchSize)
+
+	s := &DatadogSink{
+		client:  newRetryingClient(e.MaxRetries),
+		url:     strings.TrimRight(c.URL, "/"),
+		headers: headers,
+		apiKey:  key,
+		host:    c.Host,
+	}
+	if s.url == "" {
+		s.url = defaultDatadogURL
+	}
+	if s.host == "" {
+		s.host, _ = os.Hostname()
+	}
+	s.batchingSink = newBatchingSink(e.FlushInterval.Duration, e.BatchSize, s.sendBatch)
+	return s, nil
+}
+
+// sendBatch sends a batch of metrics, events and service checks. Errors are
+// logged, and the data that couldn't be sent is dropped.
+func (s *DatadogSink) sendBatch(b *batch) {
+	var metrics, distributions []datadogSeries
+	for key, p := range b.series {
+		series := datadogSeries{
+			Metric: key.name,
+			Host:   s.host,
+			Tags:   p.tags,
+		}
+		switch key.kind {
+		case seriesDistribution:
+			series.Points = []interface{}{[]interface{}{key.timestamp, p.values}}
+			distributions = append(distributions, series)
+			continue
+		case seriesSet:
+			// Sets are reported as the number of unique values.
+			series.Type = seriesGauge
+			series.Points = []interface{}{[]interface{}{key.timestamp, len(p.set)}}
+		case seriesCount:
+			series.Type = seriesCount
+			series.Interval = int64(s.interval / time.Second)
+			series.Points = []interface{}{[]interface{}{key.timestamp, p.value}}
+		default:
+			series.Type = key.kind
+			series.Points = []interface{}{[]interface{}{key.timestamp, p.value}}
+		}
+		metrics = append(metrics, series)
+	}
+
+	split(len(metrics), s.batchSize, func(i, j int) {
+		s.send("/api/v1/series", map[string]interface{}{"series": metrics[i:j]})
+	})
+	split(len(distributions), s.batchSize, func(i, j int) {
+		s.send("/api/v1/distribution_points", map[string]interface{}{"series": distributions[i:j]})
+	})
+
+	var checks []datadogCheck
+	for _, c := range b.checks {
+		check := datadogCheck{
+			Check:    c.check.Name,
+			HostName: c.check.Hostname,
+			Status:   int(c.check.Status),
+			Message:  c.check.Message,
+			Tags:     c.check.Tags,
+		}
+		t := c.t
+		if t.IsZero() {
+			t = time.Now()
+		}
+		check.Timestamp = t.Unix()
+		if check.HostName == "" {
+			check.HostName = s.host
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) > 0 {
+		s.send("/api/v1/check_run", checks)
+	}
+
+	for _, e := range b.events {
+		event := datadogEvent{
+			Title:          e.event.Title,
+			Text:           e.event.Text,
+			Host:           e.event.Hostname,
+			AggregationKey: e.event.AggregationKey,
+			Priority:       string(e.event.Priority),
+			SourceTypeName: e.event.SourceTypeName,
+			AlertType:      string(e.event.AlertType),
+			Tags:           e.event.Tags,
+		}
+		if !e.t.IsZero() {
+			event.DateHappened = e.t.Unix()
+		}
+		if event.Host == "" {
+			event.Host = s.host
+		}
+		s.send("/api/v1/events", event)
+	}
+}
+
+// send posts the body to the API, and logs an error if it fails.
+func (s *DatadogSink) send(path string, body interface{}) {
+	if err := s.post(path, body); err != nil {
+		log.Printf("error sending to Datadog %s: %v", path, err)
+	}
+}
+
+// post posts the gzipped JSON body to the API, retrying with backoff.
+func (s *DatadogSink) post(path string, body interface{}) error {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return s.client.post(s.url+path, buf.Bytes(), func() (http.Header, error) {
+		h := http.Header{
+			"Content-Type":     {"application/json"},
+			"Content-Encoding": {"gzip"},
+			"Dd-Api-Key":       {s.apiKey},
+		}
+		if err := s.headers.render(h, s.host); err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+}
@@ -0,0 +1,257 @@
+package dockerdog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDatadog is a fake Datadog API, which records the decoded body of each
+// request by path.
+type fakeDatadog struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string][]interface{}
+
+	// failures is the number of requests to fail with a 500, before
+	// succeeding.
+	failures int
+}
+
+func newFakeDatadog(t testing.TB) *fakeDatadog {
+	f := &fakeDatadog{requests: make(map[string][]interface{})}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("DD-API-KEY"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "web-1", r.Header.Get("X-Dockerdog-Host"))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failures > 0 {
+			f.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var body interface{}
+		if err := json.NewDecoder(gz).Decode(&body); err != nil {
+			t.Error(err)
+			return
+		}
+		f.requests[r.URL.Path] = append(f.requests[r.URL.Path], body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return f
+}
+
+func (f *fakeDatadog) get(path string) []interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func newTestDatadogSink(t *testing.T, url string) *DatadogSink {
+	os.Setenv("DOCKERDOG_TEST_API_KEY", "secret")
+	defer os.Unsetenv("DOCKERDOG_TEST_API_KEY")
+
+	s, err := NewDatadogSink(DatadogConfig{
+		URL:       url,
+		APIKeyEnv: "DOCKERDOG_TEST_API_KEY",
+		Host:      "web-1",
+		HTTPExportConfig: HTTPExportConfig{
+			Headers: map[string]string{"X-Dockerdog-Host": "{{.Host}}"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client.backoff = time.Millisecond
+	return s
+}
+
+func TestDatadogSink(t *testing.T) {
+	api := newFakeDatadog(t)
+	defer api.Close()
+
+	s := newTestDatadogSink(t, api.URL)
+	at := s.At(time.Unix(1500000000, 0))
+	at.Count("docker.events.container.die", 1, []string{"b:2", "a:1"}, 1)
+	at.Count("docker.events.container.die", 2, []string{"a:1", "b:2"}, 1)
+	at.Gauge("docker.crash_loop.active", 1, nil, 1)
+	at.Gauge("docker.crash_loop.active", 3, nil, 1)
+	at.Set("docker.images", "redis", nil, 1)
+	at.Set("docker.images", "redis", nil, 1)
+	at.Set("docker.images", "nginx", nil, 1)
+	at.Histogram("docker.container.exit_code", 137, nil, 1)
+	at.TimeInMilliseconds("docker.container.exit_code", 1, nil, 1)
+	e := statsd.NewEvent("web is crash looping", "web died")
+	e.AlertType = statsd.Error
+	at.Event(e)
+	at.ServiceCheck(&ServiceCheck{Name: "docker.container.health", Status: ServiceCheckCritical, Tags: []string{"name:web"}})
+	assert.NoError(t, s.Close())
+
+	series := api.get("/api/v1/series")
+	if assert.Len(t, series, 1) {
+		// Series are sent in no particular order.
+		got := make(map[string]interface{})
+		for _, s := range series[0].(map[string]interface{})["series"].([]interface{}) {
+			got[s.(map[string]interface{})["metric"].(string)] = s
+		}
+		assert.Equal(t, map[string]interface{}{
+			"docker.crash_loop.active": map[string]interface{}{
+				"metric": "docker.crash_loop.active",
+				"type":   "gauge",
+				"host":   "web-1",
+				"points": []interface{}{[]interface{}{1500000000.0, 3.0}},
+			},
+			"docker.events.container.die": map[string]interface{}{
+				"metric":   "docker.events.container.die",
+				"type":     "count",
+				"interval": 10.0,
+				"host":     "web-1",
+				"tags":     []interface{}{"a:1", "b:2"},
+				"points":   []interface{}{[]interface{}{1500000000.0, 3.0}},
+			},
+			"docker.images": map[string]interface{}{
+				"metric": "docker.images",
+				"type":   "gauge",
+				"host":   "web-1",
+				"points": []interface{}{[]interface{}{1500000000.0, 2.0}},
+			},
+		}, got)
+	}
+
+	assert.Equal(t, []interface{}{map[string]interface{}{"series": []interface{}{
+		map[string]interface{}{
+			"metric": "docker.container.exit_code",
+			"host":   "web-1",
+			"points": []interface{}{[]interface{}{1500000000.0, []interface{}{137.0, 1.0}}},
+		},
+	}}}, api.get("/api/v1/distribution_points"))
+
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"title":         "web is crash looping",
+		"text":          "web died",
+		"date_happened": 1500000000.0,
+		"host":          "web-1",
+		"alert_type":    "error",
+	}}, api.get("/api/v1/events"))
+
+	assert.Equal(t, []interface{}{[]interface{}{map[string]interface{}{
+		"check":     "docker.container.health",
+		"host_name": "web-1",
+		"status":    2.0,
+		"timestamp": 1500000000.0,
+		"tags":      []interface{}{"name:web"},
+	}}}, api.get("/api/v1/check_run"))
+}
+
+func TestDatadogSink_Retry(t *testing.T) {
+	api := newFakeDatadog(t)
+	defer api.Close()
+	api.failures = 2
+
+	s := newTestDatadogSink(t, api.URL)
+	s.Count("a", 1, nil, 1)
+	assert.NoError(t, s.Close())
+
+	assert.Len(t, api.get("/api/v1/series"), 1)
+}
+
+func TestDatadogSink_BatchSize(t *testing.T) {
+	api := newFakeDatadog(t)
+	defer api.Close()
+
+	s := newTestDatadogSink(t, api.URL)
+	s.batchSize = 2
+	for _, name := range []string{"a", "b", "c"} {
+		s.At(time.Unix(1500000000, 0)).Count(name, 1, nil, 1)
+	}
+	assert.NoError(t, s.Close())
+
+	var n int
+	for _, body := range api.get("/api/v1/series") {
+		series := body.(map[string]interface{})["series"].([]interface{})
+		assert.True(t, len(series) <= 2)
+		n += len(series)
+	}
+	assert.Equal(t, 3, n)
+}
+
+func TestDatadogConfig_JSON(t *testing.T) {
+	var c DatadogConfig
+	err := json.Unmarshal([]byte(`{"url": "https://api.datadoghq.eu", "flush_interval": "1m", "batch_size": 10, "max_retries": 5, "headers": {"X-Team": "payments"}}`), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, DatadogConfig{
+		URL: "https://api.datadoghq.eu",
+		HTTPExportConfig: HTTPExportConfig{
+			Headers:       map[string]string{"X-Team": "payments"},
+			FlushInterval: Duration{time.Minute},
+			BatchSize:     10,
+			MaxRetries:    5,
+		},
+	}, c)
+
+	e := HTTPExportConfig{}.defaults(defaultDatadogFlushInterval, defaultDatadogBatchSize)
+	assert.Equal(t, HTTPExportConfig{FlushInterval: Duration{defaultDatadogFlushInterval}, BatchSize: defaultDatadogBatchSize, MaxRetries: defaultHTTPMaxRetries}, e)
+}
+
+func TestDatadogConfig_APIKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api_key")
+	if err := ioutil.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := DatadogConfig{APIKeyFile: path}
+	key, err := c.apiKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", key)
+
+	c = DatadogConfig{APIKeyEnv: "DOCKERDOG_TEST_MISSING_KEY"}
+	_, err = c.apiKey()
+	assert.EqualError(t, err, "Datadog API key not set in $DOCKERDOG_TEST_MISSING_KEY")
+}
+
+func TestReporter_Timestamps(t *testing.T) {
+	api := newFakeDatadog(t)
+	defer api.Close()
+
+	s := newTestDatadogSink(t, api.URL)
+	config, err := LoadConfig(strings.NewReader(`{"events": {"container": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReporter(config, s)
+	r.Process(&docker.APIEvents{Type: "container", Action: "die", TimeNano: 1500000000 * int64(time.Second)})
+	assert.NoError(t, s.Close())
+
+	series := api.get("/api/v1/series")
+	if assert.Len(t, series, 1) {
+		points := series[0].(map[string]interface{})["series"].([]interface{})[0].(map[string]interface{})["points"]
+		assert.Equal(t, []interface{}{[]interface{}{1500000000.0, 1.0}}, points)
+	}
+}
@@ -0,0 +1,392 @@
+package dockerdog
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/homedir"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// DockerConfig configures how dockerdog connects to the Docker daemon. When
+// neither Host nor Context is set, the standard DOCKER_HOST, DOCKER_TLS_VERIFY
+// and DOCKER_CERT_PATH environment variables are used.
+type DockerConfig struct {
+	// Host is the endpoint of the Docker daemon, e.g.
+	// unix:///var/run/docker.sock or tcp://10.0.0.1:2376.
+	Host string `json:"host"`
+
+	// Context is the name of a Docker CLI context (see `docker context
+	// ls`) to read the endpoint and TLS material from.
+	Context string `json:"context"`
+
+	// TLSCert, TLSKey and TLSCA are paths to PEM encoded files used to
+	// connect to the daemon over TLS. If TLSCA is empty, the system root
+	// CAs are used to verify the daemon. If only TLSCA is set, no client
+	// certificate is sent. They require Host, or a Context.
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	TLSCA   string `json:"tls_ca"`
+
+	// APIVersion pins the Docker API version used for requests, e.g.
+	// "1.24". By default, the daemon's version is used.
+	APIVersion string `json:"api_version"`
+
+	// Timeout bounds how long connecting to the daemon, and waiting for
+	// the response to a request, can take.
+	Timeout Duration `json:"timeout"`
+}
+
+// newDockerClient returns a Docker client configured from c, and a daemonAPI
+// that connects to the same daemon. Both send requests through the same
+// transport, so that the timeout applies to either.
+func newDockerClient(c DockerConfig) (*docker.Client, *daemonAPI, error) {
+	var skipTLSVerify bool
+	if c.Host == "" && c.Context != "" && c.Context != "default" {
+		ctx, err := loadDockerContext(dockerConfigDir(), c.Context)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Host = ctx.Host
+		skipTLSVerify = ctx.SkipTLSVerify
+		if c.TLSCert == "" && c.TLSKey == "" {
+			c.TLSCert, c.TLSKey = ctx.TLSCert, ctx.TLSKey
+		}
+		if c.TLSCA == "" {
+			c.TLSCA = ctx.TLSCA
+		}
+	}
+
+	var (
+		client *docker.Client
+		err    error
+	)
+	useTLS := c.TLSCert != "" || c.TLSKey != "" || c.TLSCA != ""
+	switch {
+	case c.Host == "" && useTLS:
+		// The endpoint from the environment has TLS settings of its own.
+		return nil, nil, errors.New("a Docker host is required with TLS settings")
+	case c.Host == "":
+		client, err = docker.NewVersionedClientFromEnv(c.APIVersion)
+	case useTLS:
+		client, err = newDockerTLSClient(c, skipTLSVerify)
+	default:
+		client, err = docker.NewVersionedClient(c.Host, c.APIVersion)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The server version check only records the daemon's version, which
+	// isn't used, and does so without locking, racing when the client is
+	// shared between goroutines.
+	client.SkipServerVersionCheck = true
+
+	if c.Timeout.Duration > 0 {
+		client.Dialer.Timeout = c.Timeout.Duration
+		// An overall client timeout would also cut off streaming
+		// endpoints, so only bound the wait for response headers.
+		if t, ok := client.HTTPClient.Transport.(*http.Transport); ok {
+			t.ResponseHeaderTimeout = c.Timeout.Duration
+		}
+	}
+
+	api, err := newDaemonAPI(client, c.APIVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.HTTPClient = api.client
+
+	// go-dockerclient sends requests to unix sockets through an HTTP
+	// client of its own, without the timeout. Instead, send them through
+	// the daemonAPI's transport, which dials the socket whatever the
+	// host.
+	if strings.HasPrefix(client.Endpoint(), "unix://") {
+		client, err = docker.NewVersionedClient("http://"+api.base.Host, c.APIVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		client.SkipServerVersionCheck = true
+		client.HTTPClient = api.client
+	}
+
+	return client, api, nil
+}
+
+// newDockerTLSClient returns a Docker client that connects to c.Host over
+// TLS, using the configured client certificate, if any.
+func newDockerTLSClient(c DockerConfig, skipTLSVerify bool) (*docker.Client, error) {
+	var (
+		ca  []byte
+		err error
+	)
+	if c.TLSCA != "" {
+		ca, err = ioutil.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS CA: %v", err)
+		}
+	}
+
+	if c.TLSCert == "" && c.TLSKey == "" {
+		return newDockerCAClient(c, ca, skipTLSVerify)
+	}
+	if c.TLSCert == "" || c.TLSKey == "" {
+		return nil, errors.New("both a TLS certificate and key are required")
+	}
+
+	cert, err := ioutil.ReadFile(c.TLSCert)
+	if err != nil {
+		return nil, fmt.Errorf("error reading TLS certificate: %v", err)
+	}
+	key, err := ioutil.ReadFile(c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("error reading TLS key: %v", err)
+	}
+
+	client, err := docker.NewVersionedTLSClientFromBytes(c.Host, cert, key, ca, c.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// go-dockerclient disables verification entirely when no CA is
+	// given. Fall back to the system roots instead, unless the Docker
+	// context explicitly asked to skip verification.
+	client.TLSConfig.InsecureSkipVerify = skipTLSVerify
+
+	return client, nil
+}
+
+// newDockerCAClient returns a Docker client that connects to c.Host over TLS,
+// verifying the daemon with the CA, but without a client certificate, which
+// go-dockerclient can't do by itself.
+func newDockerCAClient(c DockerConfig, ca []byte, skipTLSVerify bool) (*docker.Client, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in TLS CA %s", c.TLSCA)
+	}
+
+	host := c.Host
+	if !strings.Contains(host, "://") {
+		host = "tcp://" + host
+	}
+	if !strings.HasPrefix(host, "tcp://") && !strings.HasPrefix(host, "https://") {
+		return nil, fmt.Errorf("TLS requires a tcp:// Docker host, not %q", c.Host)
+	}
+	client, err := docker.NewVersionedClient("https://"+strings.SplitN(host, "://", 2)[1], c.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	client.TLSConfig = &tls.Config{RootCAs: pool, InsecureSkipVerify: skipTLSVerify}
+	return client, nil
+}
+
+// daemonAPI makes requests against Docker API endpoints that go-dockerclient
+// doesn't support, or doesn't support well, using the same connection
+// settings as a docker.Client.
+type daemonAPI struct {
+	client *http.Client
+
+	// base is the URL that paths are relative to, including the API
+	// version if pinned.
+	base url.URL
+}
+
+// newDaemonAPI returns a daemonAPI that connects to the same daemon as c. If
+// apiVersion is not empty, requests are made against that version of the API.
+func newDaemonAPI(c *docker.Client, apiVersion string) (*daemonAPI, error) {
+	endpoint := c.Endpoint()
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "tcp://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker endpoint %q: %v", c.Endpoint(), err)
+	}
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		Dial:            dialer.Dial,
+		TLSClientConfig: c.TLSConfig,
+	}
+	if t, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+		transport.ResponseHeaderTimeout = t.ResponseHeaderTimeout
+	}
+
+	base := url.URL{Scheme: "http", Host: u.Host}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.Proxy = nil
+		transport.Dial = func(network, addr string) (net.Conn, error) {
+			return dialer.Dial("unix", socket)
+		}
+		// The host is ignored when dialing the socket.
+		base.Host = "docker"
+	case "tcp", "http", "https":
+		if c.TLSConfig != nil {
+			base.Scheme = "https"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Docker endpoint scheme %q", u.Scheme)
+	}
+
+	if apiVersion != "" {
+		base.Path = "/v" + apiVersion
+	}
+
+	return &daemonAPI{
+		client: &http.Client{Transport: transport},
+		base:   base,
+	}, nil
+}
+
+// daemonError is returned when the daemon responds with an unexpected
+// status.
+type daemonError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *daemonError) Error() string {
+	return fmt.Sprintf("Docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// get makes a GET request to path. The caller must close the response body.
+func (a *daemonAPI) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := a.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &daemonError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+
+	return resp, nil
+}
+
+// getJSON makes a GET request to path, and decodes the JSON response into v.
+func (a *daemonAPI) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	resp, err := a.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ping pings the daemon.
+func (a *daemonAPI) ping(ctx context.Context) error {
+	resp, err := a.get(ctx, "/_ping", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// dockerContext is the endpoint information for the "docker" endpoint of a
+// Docker CLI context.
+type dockerContext struct {
+	Host          string
+	SkipTLSVerify bool
+
+	// Paths to the TLS material stored for the context, if any.
+	TLSCert, TLSKey, TLSCA string
+}
+
+// dockerConfigDir returns the directory that the Docker CLI stores its
+// configuration, including contexts, in.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	return filepath.Join(homedir.Get(), ".docker")
+}
+
+// loadDockerContext reads the named Docker CLI context from the config
+// directory dir. The CLI stores each context under a directory named after
+// the sha256 digest of its name.
+func loadDockerContext(dir, name string) (*dockerContext, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("docker context %q not found", name)
+		}
+		return nil, err
+	}
+
+	var meta struct {
+		Endpoints map[string]struct {
+			Host          string `json:"Host"`
+			SkipTLSVerify bool   `json:"SkipTLSVerify"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("error parsing docker context %q: %v", name, err)
+	}
+
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("docker context %q has no docker endpoint", name)
+	}
+
+	ctx := &dockerContext{
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+
+	tlsDir := filepath.Join(dir, "contexts", "tls", id, "docker")
+	if path := filepath.Join(tlsDir, "cert.pem"); exists(path) {
+		ctx.TLSCert = path
+	}
+	if path := filepath.Join(tlsDir, "key.pem"); exists(path) {
+		ctx.TLSKey = path
+	}
+	if path := filepath.Join(tlsDir, "ca.pem"); exists(path) {
+		ctx.TLSCA = path
+	}
+
+	return ctx, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,132 @@
+package dockerdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDockerContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sum := sha256.Sum256([]byte("remote"))
+	id := hex.EncodeToString(sum[:])
+	writeFile(t, filepath.Join(dir, "contexts", "meta", id, "meta.json"), `{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2376","SkipTLSVerify":false}}}`)
+	writeFile(t, filepath.Join(dir, "contexts", "tls", id, "docker", "ca.pem"), "")
+
+	ctx, err := loadDockerContext(dir, "remote")
+	assert.NoError(t, err)
+	assert.Equal(t, &dockerContext{
+		Host:  "tcp://10.0.0.1:2376",
+		TLSCA: filepath.Join(dir, "contexts", "tls", id, "docker", "ca.pem"),
+	}, ctx)
+
+	_, err = loadDockerContext(dir, "missing")
+	assert.EqualError(t, err, `docker context "missing" not found`)
+}
+
+func TestNewDockerClient(t *testing.T) {
+	c, api, err := newDockerClient(DockerConfig{
+		Host:    "tcp://10.0.0.1:2375",
+		Timeout: Duration{5 * time.Second},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://10.0.0.1:2375", c.Endpoint())
+	assert.Equal(t, 5*time.Second, c.Dialer.Timeout)
+	assert.True(t, c.SkipServerVersionCheck)
+	assert.Equal(t, api.client, c.HTTPClient)
+	assert.Equal(t, 5*time.Second, api.client.Transport.(*http.Transport).ResponseHeaderTimeout)
+}
+
+func TestNewDockerClient_UnixTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A daemon that accepts connections, but never responds.
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, _, err := newDockerClient(DockerConfig{
+		Host:    "unix://" + socket,
+		Timeout: Duration{100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.Ping() }()
+	select {
+	case err := <-errc:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ping wasn't cut off by the timeout")
+	}
+}
+
+func TestNewDockerClient_TLSCA(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	writeFile(t, ca, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.TLS.Certificates[0].Certificate[0]})))
+
+	c, api, err := newDockerClient(DockerConfig{Host: "tcp://" + s.Listener.Addr().String(), TLSCA: ca})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, c.Ping())
+	assert.Equal(t, "https", api.base.Scheme)
+
+	_, _, err = newDockerClient(DockerConfig{Host: "tcp://" + s.Listener.Addr().String(), TLSCert: ca})
+	assert.EqualError(t, err, "both a TLS certificate and key are required")
+
+	_, _, err = newDockerClient(DockerConfig{TLSCA: ca})
+	assert.EqualError(t, err, "a Docker host is required with TLS settings")
+}
+
+func writeFile(t testing.TB, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
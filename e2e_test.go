@@ -0,0 +1,198 @@
+package dockerdog
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const e2eConfig = `{
+  "attributes": {
+    "image": true
+  },
+  "events": {
+    "container": {
+      "actions": {
+        "start": {},
+        "die": {
+          "attributes": {
+            "exitCode": true
+          }
+        },
+        "health_status": {
+          "payload": {
+            "tag": "health"
+          }
+        }
+      }
+    },
+    "image": {
+      "actions": {
+        "pull": {}
+      }
+    }
+  }
+}`
+
+func TestE2E_Events(t *testing.T) {
+	tests := []struct {
+		version string
+		packets []string
+	}{
+		{
+			version: "1.21",
+			packets: []string{
+				"docker.events.container.create:1|c|#image:nginx:1.9",
+				"docker.events.container.die:1|c|#image:nginx:1.9",
+				"docker.events.container.start:1|c|#image:nginx:1.9",
+				"docker.events.image.pull:1|c",
+			},
+		},
+		{
+			version: "1.24",
+			packets: []string{
+				"docker.events.container.create:1|c|#image:nginx:1.11",
+				"docker.events.container.die:1|c|#exitCode:137,image:nginx:1.11",
+				"docker.events.container.health_status:1|c|#health:healthy,image:nginx:1.11",
+				"docker.events.container.start:1|c|#image:nginx:1.11",
+				"docker.events.image.pull:1|c",
+			},
+		},
+		{
+			version: "1.40",
+			packets: []string{
+				"docker.events.container.create:1|c|#image:nginx:1.17",
+				"docker.events.container.die:1|c|#exitCode:1,image:nginx:1.17",
+				"docker.events.container.exec_start:1|c|#image:nginx:1.17",
+				"docker.events.container.health_status:1|c|#health:unhealthy,image:nginx:1.17",
+				"docker.events.container.start:1|c|#image:nginx:1.17",
+				"docker.events.image.pull:1|c",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		packets, d := runE2E(t, tt.version, e2eConfig)
+		assert.Equal(t, tt.packets, packets, tt.version)
+		assert.Contains(t, d.paths(), "/events", tt.version)
+	}
+}
+
+func TestE2E_Queue(t *testing.T) {
+	// Queued events are all reported before the watcher returns.
+	expected, _ := runE2E(t, "1.40", e2eConfig)
+	queued, _ := runE2E(t, "1.40", strings.Replace(e2eConfig, `"events"`, `"queue": {"workers": 4, "size": 2},
+  "events"`, 1))
+	assert.Equal(t, expected, queued)
+}
+
+func TestE2E_Presets(t *testing.T) {
+	packets, _ := runE2E(t, "1.40", `{
+  "presets": ["compose"],
+  "events": {
+    "container": {
+      "actions": {
+        "create": {
+          "attributes": {
+            "com.docker.compose.service": false
+          }
+        }
+      }
+    }
+  }
+}`)
+
+	assert.Equal(t, []string{
+		"docker.events.container.create:1|c|#compose_project:shop",
+		"docker.events.container.die:1|c|#compose_project:shop,compose_service:web",
+		"docker.events.container.exec_start:1|c|#compose_project:shop,compose_service:web",
+		"docker.events.container.health_status:1|c|#compose_project:shop,compose_service:web",
+		"docker.events.container.start:1|c|#compose_project:shop,compose_service:web",
+	}, packets)
+}
+
+func TestE2E_ServiceChecks(t *testing.T) {
+	packets, _ := runE2E(t, "1.24", `{
+  "service_checks": {},
+  "events": {}
+}`)
+
+	assert.Equal(t, []string{
+		"_sc|docker.container.health|0|d:1470000002|#container_name:web|m:container web is healthy",
+		"_sc|dockerdog.can_connect|0",
+	}, packets)
+}
+
+func TestE2E_ReaderSource(t *testing.T) {
+	// Events recorded with `docker events --format '{{json .}}'` are
+	// reported the same as events streamed from the daemon.
+	daemon, _ := runE2E(t, "1.24", e2eConfig)
+
+	capture := newFakeStatsd(t)
+	defer capture.Close()
+	s, err := NewStatsdSink(capture.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(strings.NewReader(e2eConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/events/1.24.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := NewWatcher(config, s, WithSource(&ReaderSource{Reader: f}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	assert.Equal(t, daemon, capture.packets())
+}
+
+// runE2E runs dockerdog with the given config against a fake Docker daemon
+// for the API version, until all of its events have been reported, and
+// returns the packets sent to statsd.
+func runE2E(t testing.TB, version, configJSON string) ([]string, *fakeDocker) {
+	d := newFakeDocker(t, version)
+	defer d.Close()
+	capture := newFakeStatsd(t)
+	defer capture.Close()
+
+	config, err := LoadConfig(strings.NewReader(configJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Docker.Host = d.URL
+	config.Docker.APIVersion = version
+
+	s, err := NewStatsdSink(capture.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake daemon ends the stream once until is set.
+	w, err := NewWatcher(config, s, WithUntil(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	return capture.packets(), d
+}
@@ -0,0 +1,254 @@
+package dockerdog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// errEventStreamClosed is returned when the daemon closes the event stream.
+var errEventStreamClosed = errors.New("event stream closed by the Docker daemon")
+
+// eventStream reads events from the Docker daemon's /events endpoint. Unlike
+// go-dockerclient's event listeners, events are filtered by the daemon, and
+// errors are returned to the caller instead of being retried.
+type eventStream struct {
+	api *daemonAPI
+
+	// filters are passed to the daemon as the `filters` query parameter.
+	filters map[string][]string
+}
+
+func newEventStream(api *daemonAPI, filters map[string][]string) *eventStream {
+	return &eventStream{
+		api:     api,
+		filters: filters,
+	}
+}
+
+// Stream sends events to ch until ctx is cancelled, or the stream ends. If
+// until is set, the daemon ends the stream once it's passed, and Stream
+// returns nil. Otherwise errEventStreamClosed is returned when the stream
+// ends. Decode errors are returned immediately.
+func (s *eventStream) Stream(ctx context.Context, since, until time.Time, ch chan<- *docker.APIEvents) error {
+	resp, err := s.api.get(ctx, "/events", s.query(since, until))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("could not connect to event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event docker.APIEvents
+		if err := decoder.Decode(&event); err != nil {
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case err == io.EOF && !until.IsZero():
+				return nil
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				return errEventStreamClosed
+			default:
+				return fmt.Errorf("error decoding event: %v", err)
+			}
+		}
+
+		normalizeEvent(&event)
+
+		select {
+		case ch <- &event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// query returns the query to stream events with.
+func (s *eventStream) query(since, until time.Time) url.Values {
+	q := url.Values{}
+	if len(s.filters) > 0 {
+		raw, _ := json.Marshal(s.filters)
+		q.Set("filters", string(raw))
+	}
+	if !since.IsZero() {
+		q.Set("since", strconv.FormatInt(since.Unix(), 10))
+	}
+	if !until.IsZero() {
+		q.Set("until", strconv.FormatInt(until.Unix(), 10))
+	}
+	return q
+}
+
+// containerStateActions are the actions that change the state of containers,
+// as listed by the daemon. They're always streamed with container events, so
+// that the watchdog can compare container activity with the events received.
+var containerStateActions = []string{"create", "start", "die", "pause", "unpause", "destroy"}
+
+// eventFilters returns the filters to pass to the daemon, so that it only
+// sends the events that dockerdog will report. Filters set in the config are
+// used as is, the `type` filter defaults to the configured event types, and
+// the `event` filter to the configured actions.
+func eventFilters(config *Config) map[string][]string {
+	filters := make(map[string][]string)
+	for k, v := range config.Filters {
+		filters[k] = v
+	}
+
+	if _, ok := filters["type"]; !ok {
+		types := make(map[string]bool)
+		for t := range config.Events {
+			types[t] = true
+		}
+		for _, m := range config.Metrics {
+			types[m.Event] = true
+		}
+		// Crash loop detection, service checks, stats collection and
+		// traces rely on container events, even if they're not
+		// reported as metrics.
+		if config.CrashLoop != nil || config.ServiceChecks != nil || config.Stats != nil || config.Traces != nil {
+			types["container"] = true
+		}
+		all := false
+		for _, events := range outputEvents(config) {
+			if len(events) == 0 {
+				// The output wants every event, so the daemon
+				// must send every type.
+				all = true
+			}
+			for t := range events {
+				types[t] = true
+			}
+		}
+		if !all {
+			for t := range types {
+				filters["type"] = append(filters["type"], t)
+			}
+			sort.Strings(filters["type"])
+		}
+	}
+
+	if _, ok := filters["event"]; !ok {
+		if actions := eventActions(config); actions != nil {
+			filters["event"] = actions
+		}
+	}
+
+	return filters
+}
+
+// eventActions returns the actions that are reported, or nil if every action
+// is needed. The daemon matches actions with payloads, like
+// "exec_start: /bin/sh", by their prefix.
+func eventActions(config *Config) []string {
+	// Crash loop detection, service checks, stats collection and traces
+	// follow the lifecycle of containers through many actions.
+	if config.CrashLoop != nil || config.ServiceChecks != nil || config.Stats != nil || config.Traces != nil {
+		return nil
+	}
+
+	// Every action of a configured event type is counted.
+	if len(config.Events) > 0 {
+		return nil
+	}
+
+	actions := make(map[string]bool)
+	for _, m := range config.Metrics {
+		if m.Action == "" {
+			return nil
+		}
+		actions[m.Action] = true
+	}
+	for _, events := range outputEvents(config) {
+		if len(events) == 0 {
+			return nil
+		}
+		for _, a := range events {
+			if len(a) == 0 {
+				return nil
+			}
+			for _, action := range a {
+				actions[action] = true
+			}
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	for _, a := range containerStateActions {
+		actions[a] = true
+	}
+
+	var list []string
+	for a := range actions {
+		list = append(list, a)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// outputEvents returns the events selected by each webhook and audit log.
+func outputEvents(config *Config) []map[string][]string {
+	var events []map[string][]string
+	for _, w := range config.Webhooks {
+		events = append(events, w.Events)
+	}
+	for _, s := range config.Syslog {
+		events = append(events, s.Events)
+	}
+	if config.Journald != nil {
+		events = append(events, config.Journald.Events)
+	}
+	return events
+}
+
+// normalizeEvent populates the Type, Action and Actor of events from daemons
+// older than API version 1.22, which only set Status, ID and From.
+func normalizeEvent(event *docker.APIEvents) {
+	if event.Type != "" || event.Action != "" {
+		return
+	}
+
+	event.Action = event.Status
+	event.Actor.ID = event.ID
+	event.Actor.Attributes = map[string]string{}
+	switch event.Status {
+	case "delete", "import", "pull", "push", "tag", "untag":
+		event.Type = "image"
+	default:
+		event.Type = "container"
+		if event.From != "" {
+			event.Actor.Attributes["image"] = event.From
+		}
+	}
+}
+
+// ParseTimestamp parses a timestamp in one of the formats accepted by
+// `docker events --since`: a Unix timestamp, an RFC 3339 date, or a duration
+// relative to now, e.g. "10m".
+func ParseTimestamp(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
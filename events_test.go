@@ -0,0 +1,146 @@
+package dockerdog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventStream_Stream(t *testing.T) {
+	var query string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.24/events", r.URL.Path)
+		query = r.URL.RawQuery
+		fmt.Fprintln(w, `{"Type":"container","Action":"start","Actor":{"ID":"abcd","Attributes":{"image":"nginx"}},"time":1470000000}`)
+		fmt.Fprintln(w, `{"status":"pull","id":"nginx:latest","time":1470000001}`)
+	}))
+	defer s.Close()
+
+	stream := newTestEventStream(t, s.URL, map[string][]string{"type": {"container", "image"}})
+
+	events := make(chan *docker.APIEvents, 2)
+	err := stream.Stream(context.Background(), time.Unix(1470000000, 0), time.Time{}, events)
+	assert.Equal(t, errEventStreamClosed, err)
+	assert.Equal(t, `filters=%7B%22type%22%3A%5B%22container%22%2C%22image%22%5D%7D&since=1470000000`, query)
+
+	close(events)
+	var got []string
+	for event := range events {
+		got = append(got, fmt.Sprintf("%s %s %s", event.Type, event.Action, event.Actor.ID))
+	}
+	assert.Equal(t, []string{"container start abcd", "image pull nginx:latest"}, got)
+
+	// Reaching until ends the stream without an error.
+	err = stream.Stream(context.Background(), time.Time{}, time.Unix(1470000002, 0), make(chan *docker.APIEvents, 2))
+	assert.NoError(t, err)
+}
+
+func TestEventStream_Stream_DecodeError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"Type":`)
+		fmt.Fprintln(w, `}`)
+	}))
+	defer s.Close()
+
+	err := newTestEventStream(t, s.URL, nil).Stream(context.Background(), time.Time{}, time.Time{}, make(chan *docker.APIEvents))
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "error decoding event"), err.Error())
+	}
+}
+
+func TestEventStream_Stream_Cancel(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- newTestEventStream(t, s.URL, nil).Stream(ctx, time.Time{}, time.Time{}, make(chan *docker.APIEvents))
+	}()
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestEventFilters(t *testing.T) {
+	config := testConfig(t)
+	assert.Equal(t, map[string][]string{"type": {"container", "image"}}, eventFilters(config))
+
+	// Every action of a counted event type is streamed.
+	config.Metrics = []MetricConfig{{Name: "docker.networks.connected", Type: "count", Event: "network", Action: "connect"}}
+	assert.Equal(t, map[string][]string{"type": {"container", "image", "network"}}, eventFilters(config))
+
+	events := config.Events
+	config.Events = nil
+	assert.Equal(t, map[string][]string{
+		"type":  {"network"},
+		"event": {"connect", "create", "destroy", "die", "pause", "start", "unpause"},
+	}, eventFilters(config))
+
+	config.Syslog = []SyslogConfig{{Events: map[string][]string{"plugin": {"enable"}}}}
+	assert.Equal(t, map[string][]string{
+		"type":  {"network", "plugin"},
+		"event": {"connect", "create", "destroy", "die", "enable", "pause", "start", "unpause"},
+	}, eventFilters(config))
+
+	// A type without actions needs every action.
+	config.Webhooks = []WebhookConfig{{URL: "http://localhost", Events: map[string][]string{"volume": nil}}}
+	assert.Equal(t, map[string][]string{"type": {"network", "plugin", "volume"}}, eventFilters(config))
+
+	config.Webhooks = nil
+	config.Stats = &StatsConfig{}
+	assert.Equal(t, map[string][]string{"type": {"container", "network", "plugin"}}, eventFilters(config))
+
+	config.Stats = nil
+	config.Events = events
+	config.Journald = &JournaldConfig{}
+	assert.Equal(t, map[string][]string{}, eventFilters(config))
+
+	config.Journald = nil
+	config.Filters = map[string][]string{"label": {"team=payments"}, "type": {"container"}, "event": {"die"}}
+	assert.Equal(t, map[string][]string{"label": {"team=payments"}, "type": {"container"}, "event": {"die"}}, eventFilters(config))
+}
+
+func TestParseTimestamp(t *testing.T) {
+	now := time.Unix(1470000000, 0)
+
+	tests := []struct {
+		in  string
+		out time.Time
+	}{
+		{"", time.Time{}},
+		{"10m", now.Add(-10 * time.Minute)},
+		{"1469999000", time.Unix(1469999000, 0)},
+		{"2016-07-31T21:20:00Z", time.Date(2016, 7, 31, 21, 20, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		out, err := ParseTimestamp(tt.in, now)
+		assert.NoError(t, err)
+		assert.True(t, tt.out.Equal(out), "%s: %v != %v", tt.in, tt.out, out)
+	}
+
+	_, err := ParseTimestamp("yesterday", now)
+	assert.Error(t, err)
+}
+
+func newTestEventStream(t testing.TB, endpoint string, filters map[string][]string) *eventStream {
+	c, err := docker.NewClient(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := newDaemonAPI(c, "1.24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newEventStream(api, filters)
+}
@@ -0,0 +1,283 @@
+package dockerdog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// versionPrefix matches the API version that requests can be prefixed with.
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// fakeDocker is a fake Docker daemon, which serves the endpoints dockerdog
+// uses from fixtures.
+type fakeDocker struct {
+	*httptest.Server
+
+	// version is the API version reported by /version.
+	version string
+
+	// events are the raw JSON events sent by /events.
+	events [][]byte
+
+	// containers are returned by /containers/json, and inspected with
+	// /containers/{id}/json.
+	containers []docker.APIContainers
+
+	mu sync.Mutex
+	// requests are the paths requested, without the version prefix.
+	requests []string
+	// stats counts the open stats streams of each container.
+	stats map[string]int
+}
+
+// newFakeDocker returns a fake Docker daemon for the given API version,
+// which sends the events in testdata/events/<version>.json and lists the
+// containers in testdata/containers.json.
+func newFakeDocker(t testing.TB, version string) *fakeDocker {
+	d := &fakeDocker{version: version, stats: make(map[string]int)}
+
+	raw, err := ioutil.ReadFile("testdata/events/" + version + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			d.events = append(d.events, append([]byte(nil), line...))
+		}
+	}
+
+	raw, err = ioutil.ReadFile("testdata/containers.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &d.containers); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serveHTTP))
+	return d
+}
+
+func (d *fakeDocker) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	d.mu.Lock()
+	d.requests = append(d.requests, path)
+	d.mu.Unlock()
+
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+	case path == "/version":
+		writeJSON(w, map[string]string{"ApiVersion": d.version})
+	case path == "/events":
+		d.serveEvents(w, r)
+	case path == "/containers/json":
+		writeJSON(w, d.containers)
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/stats"):
+		d.serveStats(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/stats"))
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		for _, c := range d.containers {
+			if c.ID == id || strings.HasPrefix(c.ID, id) {
+				writeJSON(w, d.inspect(c))
+				return
+			}
+		}
+		http.Error(w, `{"message":"No such container: `+id+`"}`, http.StatusNotFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents sends the events matching the type and event filters. Like the
+// daemon, actions with payloads match by prefix, and the stream is ended once
+// until is set, and otherwise held open.
+func (d *fakeDocker) serveEvents(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if raw := r.URL.Query().Get("filters"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &filters); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	types := make(map[string]bool)
+	for _, t := range filters["type"] {
+		types[t] = true
+	}
+
+	actions := make(map[string]bool)
+	for _, a := range filters["event"] {
+		actions[a] = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	for _, raw := range d.events {
+		var event struct{ Type, Action, Status string }
+		json.Unmarshal(raw, &event)
+		// Events from older daemons don't have a type to filter by.
+		if len(types) > 0 && event.Type != "" && !types[event.Type] {
+			continue
+		}
+		action := event.Action
+		if action == "" {
+			action = event.Status
+		}
+		if action, _ := splitAction(action); len(actions) > 0 && !actions[action] {
+			continue
+		}
+		w.Write(append(raw, '\n'))
+	}
+	w.(http.Flusher).Flush()
+
+	if r.URL.Query().Get("until") == "" {
+		<-r.Context().Done()
+	}
+}
+
+// serveStats streams a stats sample for the container every 10ms, until the
+// client goes away.
+func (d *fakeDocker) serveStats(w http.ResponseWriter, r *http.Request, id string) {
+	d.mu.Lock()
+	d.stats[id]++
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.stats[id]--
+		if d.stats[id] == 0 {
+			delete(d.stats, id)
+		}
+		d.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	for {
+		writeJSON(w, map[string]interface{}{
+			"read":      time.Now(),
+			"cpu_stats": map[string]interface{}{"cpu_usage": map[string]interface{}{"total_usage": 100}, "system_cpu_usage": 1000},
+		})
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// openStats returns the IDs of the containers with open stats streams.
+func (d *fakeDocker) openStats() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ids []string
+	for id := range d.stats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// inspect returns the response from /containers/{id}/json for a container.
+func (d *fakeDocker) inspect(c docker.APIContainers) interface{} {
+	name := ""
+	if len(c.Names) > 0 {
+		name = c.Names[0]
+	}
+	return map[string]interface{}{
+		"Id":    c.ID,
+		"Name":  name,
+		"Image": c.Image,
+		"Config": map[string]interface{}{
+			"Image":  c.Image,
+			"Labels": c.Labels,
+		},
+		"State": map[string]interface{}{
+			"Status":  c.State,
+			"Running": c.State == "running",
+		},
+	}
+}
+
+// paths returns the paths that were requested.
+func (d *fakeDocker) paths() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.requests...)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fakeStatsd captures the packets sent to a local UDP listener.
+type fakeStatsd struct {
+	conn net.PacketConn
+}
+
+func newFakeStatsd(t testing.TB) *fakeStatsd {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeStatsd{conn: conn}
+}
+
+// Addr returns the address to send packets to.
+func (s *fakeStatsd) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close closes the listener.
+func (s *fakeStatsd) Close() error {
+	return s.conn.Close()
+}
+
+// packets returns the packets received until none arrive for 100ms, sorted
+// and with their tags sorted, so that they can be compared.
+func (s *fakeStatsd) packets() []string {
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		for _, p := range strings.Split(string(buf[:n]), "\n") {
+			if p != "" {
+				packets = append(packets, sortTags(p))
+			}
+		}
+	}
+	sort.Strings(packets)
+	return packets
+}
+
+// sortTags sorts the tags of a metric or service check packet.
+func sortTags(packet string) string {
+	fields := strings.Split(packet, "|")
+	for i, f := range fields {
+		if strings.HasPrefix(f, "#") {
+			tags := strings.Split(f[1:], ",")
+			sort.Strings(tags)
+			fields[i] = "#" + strings.Join(tags, ",")
+		}
+	}
+	return strings.Join(fields, "|")
+}
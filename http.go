@@ -0,0 +1,192 @@
+package dockerdog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// minHTTPBackoff is how long to wait before retrying a failed request,
+	// which doubles with each retry, up to maxHTTPBackoff.
+	minHTTPBackoff = time.Second
+	maxHTTPBackoff = 30 * time.Second
+
+	// httpTimeout is how long a single request can take.
+	httpTimeout = 30 * time.Second
+
+	defaultHTTPMaxRetries = 3
+)
+
+// HTTPExportConfig configures how a sink or output that sends batches over
+// HTTP, like Datadog or a webhook, batches and sends them. It's embedded in
+// their configs.
+type HTTPExportConfig struct {
+	// Headers are added to each request. Values are templates, which can
+	// use {{env "NAME"}} and {{.Host}}.
+	Headers map[string]string `json:"headers"`
+
+	// FlushInterval is how often buffered data is sent.
+	FlushInterval Duration `json:"flush_interval"`
+
+	// BatchSize is the most series, events or spans sent in a single
+	// request. Data is also sent as soon as this many are buffered.
+	BatchSize int `json:"batch_size"`
+
+	// MaxRetries is how many times a request is retried when it fails
+	// with a network error, or a 429 or 5xx response.
+	MaxRetries int `json:"max_retries"`
+}
+
+// defaults returns c, with the given flush interval and batch size, and the
+// default number of retries, where they aren't set.
+func (c HTTPExportConfig) defaults(interval time.Duration, batchSize int) HTTPExportConfig {
+	if c.FlushInterval.Duration <= 0 {
+		c.FlushInterval.Duration = interval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = batchSize
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultHTTPMaxRetries
+	}
+	return c
+}
+
+// retryingClient posts to HTTP APIs, retrying requests that fail with a
+// network error, or a 429 or 5xx response, with exponential backoff.
+type retryingClient struct {
+	client     *http.Client
+	maxRetries int
+
+	// backoff is how long to wait before the first retry.
+	backoff time.Duration
+}
+
+func newRetryingClient(maxRetries int) *retryingClient {
+	return &retryingClient{
+		client:     &http.Client{Timeout: httpTimeout},
+		maxRetries: maxRetries,
+		backoff:    minHTTPBackoff,
+	}
+}
+
+// post posts body to url, with the headers returned by header, which is
+// called for each attempt.
+func (c *retryingClient) post(url string, body []byte, header func() (http.Header, error)) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.do(url, body, header)
+		if err == nil || !retry || attempt >= c.maxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxHTTPBackoff {
+			backoff = maxHTTPBackoff
+		}
+	}
+}
+
+// do makes a single request, and returns whether it should be retried if it
+// fails.
+func (c *retryingClient) do(url string, body []byte, header func() (http.Header, error)) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	h, err := header()
+	if err != nil {
+		return false, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%s", resp.Status)
+	case resp.StatusCode >= 400:
+		return false, fmt.Errorf("%s", resp.Status)
+	}
+	return false, nil
+}
+
+// flushLoop calls flush every interval, or when full is signalled, and a last
+// time once done is closed.
+func flushLoop(interval time.Duration, full, done <-chan bool, flush func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-full:
+		case <-done:
+			flush()
+			return
+		}
+		flush()
+	}
+}
+
+// readSecret reads a secret, like an API key, from file if it's set, or
+// otherwise from the environment variable env.
+func readSecret(name, file, env string) (string, error) {
+	if file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %v", name, err)
+		}
+		return strings.TrimSpace(string(raw)), nil
+	}
+
+	secret := os.Getenv(env)
+	if secret == "" {
+		return "", fmt.Errorf("%s not set in $%s", name, env)
+	}
+	return secret, nil
+}
+
+// headerTemplates are the templates for the values of configured headers,
+// which can use {{env "NAME"}} and {{.Host}}.
+type headerTemplates map[string]*template.Template
+
+// parseHeaders parses the templates for the headers.
+func parseHeaders(headers map[string]string) (headerTemplates, error) {
+	templates := make(headerTemplates)
+	for name, value := range headers {
+		t, err := template.New(name).Funcs(template.FuncMap{"env": os.Getenv}).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// render sets the headers in h.
+func (t headerTemplates) render(h http.Header, host string) error {
+	data := struct{ Host string }{host}
+	for name, tmpl := range t {
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil {
+			return fmt.Errorf("error rendering header %s: %v", name, err)
+		}
+		h.Set(name, value.String())
+	}
+	return nil
+}
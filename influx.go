@@ -0,0 +1,251 @@
+package dockerdog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInfluxFlushInterval = 10 * time.Second
+	defaultInfluxBatchSize     = 5000
+
+	// influxPacketSize is the most bytes of lines sent in a UDP packet,
+	// so that packets aren't fragmented.
+	influxPacketSize = 1400
+)
+
+// InfluxConfig configures writing metrics to InfluxDB, in the line protocol.
+type InfluxConfig struct {
+	// URL is either a UDP address, like "udp://localhost:8089", or the
+	// HTTP write endpoint, including the database or bucket, like
+	// "http://localhost:8086/write?db=docker" or
+	// "http://localhost:8086/api/v2/write?org=example&bucket=docker".
+	URL string `json:"url"`
+
+	// TokenFile or TokenEnv authenticate HTTP writes with a token read
+	// from a file or environment variable.
+	TokenFile string `json:"token_file"`
+	TokenEnv  string `json:"token_env"`
+
+	// Headers and MaxRetries only apply to HTTP writes.
+	HTTPExportConfig
+}
+
+// InfluxSink is a Sink that writes to InfluxDB. Metrics are aggregated, and
+// written in batches every flush interval. Counts, gauges and sets are points
+// with a value field, histograms have count, sum, min and max fields, and
+// service checks have status and message fields. Events are points in the
+// events measurement, with title and text fields.
+type InfluxSink struct {
+	*batchingSink
+
+	// conn is nil when writing over HTTP.
+	conn net.Conn
+
+	client  *retryingClient
+	url     string
+	headers headerTemplates
+	token   string
+	host    string
+}
+
+// NewInfluxSink returns an InfluxSink, and starts writing metrics.
+func NewInfluxSink(c InfluxConfig) (*InfluxSink, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB url: %v", err)
+	}
+
+	headers, err := parseHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	e := c.HTTPExportConfig.defaults(defaultInfluxFlushInterval, defaultInfluxBatchSize)
+
+	s := &InfluxSink{headers: headers}
+	s.host, _ = os.Hostname()
+	switch u.Scheme {
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	case "http", "https":
+		s.client = newRetryingClient(e.MaxRetries)
+		s.url = c.URL
+		if c.TokenFile != "" || c.TokenEnv != "" {
+			token, err := readSecret("InfluxDB token", c.TokenFile, c.TokenEnv)
+			if err != nil {
+				return nil, err
+			}
+			s.token = token
+		}
+	default:
+		return nil, fmt.Errorf("InfluxDB url must be udp, http or https, not %q", u.Scheme)
+	}
+	s.batchingSink = newBatchingSink(e.FlushInterval.Duration, e.BatchSize, s.sendBatch)
+	return s, nil
+}
+
+// Close writes any buffered metrics, and closes the UDP connection.
+func (s *InfluxSink) Close() error {
+	err := s.batchingSink.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// sendBatch writes a batch of metrics, events and service checks. Errors are
+// logged, and the points that couldn't be written are dropped.
+func (s *InfluxSink) sendBatch(b *batch) {
+	var lines []string
+	for key, p := range b.series {
+		var fields string
+		switch key.kind {
+		case seriesDistribution:
+			fields = influxSummary(p.values)
+		case seriesSet:
+			fields = "value=" + influxFloat(float64(len(p.set)))
+		default:
+			fields = "value=" + influxFloat(p.value)
+		}
+		lines = append(lines, influxLine(key.name, p.tags, fields, time.Unix(key.timestamp, 0)))
+	}
+
+	for _, c := range b.checks {
+		fields := fmt.Sprintf("status=%di", c.check.Status)
+		if c.check.Message != "" {
+			fields += ",message=" + influxString(c.check.Message)
+		}
+		lines = append(lines, influxLine(c.check.Name, c.check.Tags, fields, influxTime(c.t)))
+	}
+
+	for _, e := range b.events {
+		tags := append([]string(nil), e.event.Tags...)
+		if e.event.AlertType != "" {
+			tags = append(tags, "alert_type:"+string(e.event.AlertType))
+		}
+		if e.event.AggregationKey != "" {
+			tags = append(tags, "aggregation_key:"+e.event.AggregationKey)
+		}
+		fields := "title=" + influxString(e.event.Title) + ",text=" + influxString(e.event.Text)
+		lines = append(lines, influxLine("events", tags, fields, influxTime(e.t)))
+	}
+
+	split(len(lines), s.batchSize, func(i, j int) {
+		if err := s.write(lines[i:j]); err != nil {
+			log.Printf("error writing to InfluxDB: %v", err)
+		}
+	})
+}
+
+// write writes lines over UDP, in as few packets as possible, or over HTTP.
+func (s *InfluxSink) write(lines []string) error {
+	if s.conn == nil {
+		body := []byte(strings.Join(lines, "\n") + "\n")
+		return s.client.post(s.url, body, func() (http.Header, error) {
+			h := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+			if s.token != "" {
+				h.Set("Authorization", "Token "+s.token)
+			}
+			if err := s.headers.render(h, s.host); err != nil {
+				return nil, err
+			}
+			return h, nil
+		})
+	}
+
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > influxPacketSize {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		packet.WriteString(line)
+		packet.WriteString("\n")
+	}
+	if packet.Len() > 0 {
+		_, err := s.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+// influxTime returns t, or now if it's zero.
+func influxTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// influxLine returns a point in the line protocol. Tags are sorted by key,
+// and tags without a value are given the value "true", since InfluxDB doesn't
+// allow empty tag values.
+func influxLine(measurement string, tags []string, fields string, t time.Time) string {
+	pairs := make(influxTags, 0, len(tags))
+	for _, tag := range tags {
+		k, v := tagValue(tag)
+		if v == "" {
+			v = "true"
+		}
+		pairs = append(pairs, [2]string{k, v})
+	}
+	sort.Sort(pairs)
+
+	var b bytes.Buffer
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+	for _, pair := range pairs {
+		b.WriteString(",")
+		b.WriteString(influxTagEscaper.Replace(pair[0]))
+		b.WriteString("=")
+		b.WriteString(influxTagEscaper.Replace(pair[1]))
+	}
+	b.WriteString(" ")
+	b.WriteString(fields)
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	return b.String()
+}
+
+// influxSummary returns the fields that summarize a histogram.
+func influxSummary(values []float64) string {
+	sum, min, max := summarize(values)
+	return fmt.Sprintf("count=%di,sum=%s,min=%s,max=%s", len(values), influxFloat(sum), influxFloat(min), influxFloat(max))
+}
+
+func influxFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func influxString(s string) string {
+	return `"` + influxStringEscaper.Replace(s) + `"`
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	influxStringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// influxTags sorts tags by key.
+type influxTags [][2]string
+
+func (t influxTags) Len() int           { return len(t) }
+func (t influxTags) Less(i, j int) bool { return t[i][0] < t[j][0] }
+func (t influxTags) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,85 @@
+package dockerdog
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxSink_HTTP(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+
+	os.Setenv("DOCKERDOG_TEST_INFLUX_TOKEN", "secret")
+	defer os.Unsetenv("DOCKERDOG_TEST_INFLUX_TOKEN")
+
+	s, err := NewInfluxSink(InfluxConfig{URL: api.URL + "/write?db=docker", TokenEnv: "DOCKERDOG_TEST_INFLUX_TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := s.At(time.Unix(1500000000, 0))
+	at.Count("docker.events.container.die", 1, []string{"name:web", "exitCode:1"}, 1)
+	at.Count("docker.events.container.die", 2, []string{"exitCode:1", "name:web"}, 1)
+	at.Gauge("docker.crash_loop.active", 1.5, nil, 1)
+	at.Set("docker.images", "redis", []string{"canary"}, 1)
+	at.Histogram("docker.container.exit_code", 137, nil, 1)
+	at.Histogram("docker.container.exit_code", 1, nil, 1)
+	at.ServiceCheck(&ServiceCheck{Name: "docker.container.health", Status: ServiceCheckCritical, Message: `"web" is unhealthy`, Tags: []string{"container_name:web"}})
+	e := statsd.NewEvent("web is crash looping", "web died 5 times")
+	e.AlertType = statsd.Error
+	e.Tags = []string{"service:web"}
+	at.Event(e)
+	assert.NoError(t, s.Close())
+
+	requests, bodies := api.received()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	assert.Equal(t, "/write", requests[0].URL.Path)
+	assert.Equal(t, "docker", requests[0].URL.Query().Get("db"))
+	assert.Equal(t, "Token secret", requests[0].Header.Get("Authorization"))
+
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{
+		`docker.container.exit_code count=2i,sum=138,min=1,max=137 1500000000000000000`,
+		`docker.container.health,container_name=web status=2i,message="\"web\" is unhealthy" 1500000000000000000`,
+		`docker.crash_loop.active value=1.5 1500000000000000000`,
+		`docker.events.container.die,exitCode=1,name=web value=3 1500000000000000000`,
+		`docker.images,canary=true value=1 1500000000000000000`,
+		`events,alert_type=error,service=web title="web is crash looping",text="web died 5 times" 1500000000000000000`,
+	}, lines)
+}
+
+func TestInfluxSink_UDP(t *testing.T) {
+	influx := newFakeStatsd(t)
+	defer influx.Close()
+
+	s, err := NewInfluxSink(InfluxConfig{URL: "udp://" + influx.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.At(time.Unix(1500000000, 0)).Count("docker.events.container.start", 1, []string{"name:web-" + strings.Repeat("x", i)}, 1)
+	}
+	assert.NoError(t, s.Close())
+
+	assert.Len(t, influx.packets(), 100)
+}
+
+func TestInfluxLine(t *testing.T) {
+	assert.Equal(t,
+		`docker\ events,a=1,b\,c=d\=e\ f value=1 1500000000000000000`,
+		influxLine("docker events", []string{"b,c:d=e f", "a:1"}, "value=1", time.Unix(1500000000, 0)),
+	)
+}
+
+func TestNewInfluxSink_Invalid(t *testing.T) {
+	_, err := NewInfluxSink(InfluxConfig{URL: "tcp://localhost:8089"})
+	assert.EqualError(t, err, `InfluxDB url must be udp, http or https, not "tcp"`)
+}
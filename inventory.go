@@ -0,0 +1,223 @@
+package dockerdog
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// defaultInventoryInterval is how often the inventory is collected, when not
+// configured.
+const defaultInventoryInterval = time.Minute
+
+// InventoryConfig configures the periodic collection of gauges for the
+// images, containers and volumes on the host.
+type InventoryConfig struct {
+	// Interval is how often the inventory is collected.
+	Interval Duration `json:"interval"`
+}
+
+// inventory is a summary of the images, containers and volumes on the host.
+// Sizes are in bytes.
+type inventory struct {
+	Images, DanglingImages         int
+	ImagesSize, DanglingImagesSize int64
+
+	StoppedContainers     int
+	StoppedContainersSize int64
+
+	Volumes, UnusedVolumes         int
+	VolumesSize, UnusedVolumesSize int64
+
+	// diskUsage is true when the inventory was collected with `docker
+	// system df` (API version 1.25 and later). Otherwise, the sizes of
+	// containers and volumes are unknown, and ImagesSize counts layers
+	// that are shared between images more than once.
+	diskUsage bool
+}
+
+// diskUsage is the response from /system/df.
+type diskUsage struct {
+	LayersSize int64
+	Images     []struct {
+		RepoTags []string
+		Size     int64
+	}
+	Containers []struct {
+		State  string
+		SizeRw int64
+	}
+	Volumes []struct {
+		UsageData *struct {
+			Size     int64
+			RefCount int64
+		}
+	}
+}
+
+// inventoryCollector periodically reports the inventory to a Sink.
+type inventoryCollector struct {
+	client   *docker.Client
+	api      *daemonAPI
+	sink     Sink
+	interval time.Duration
+}
+
+func newInventoryCollector(c *docker.Client, api *daemonAPI, s Sink, config InventoryConfig) *inventoryCollector {
+	interval := config.Interval.Duration
+	if interval <= 0 {
+		interval = defaultInventoryInterval
+	}
+	return &inventoryCollector{
+		client:   c,
+		api:      api,
+		sink:     s,
+		interval: interval,
+	}
+}
+
+// run reports the inventory every interval until ctx is cancelled.
+func (c *inventoryCollector) run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		inv, err := c.collect(ctx)
+		if err != nil {
+			log.Printf("error collecting inventory: %v", err)
+		} else {
+			reportInventory(c.sink, inv)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collect collects the inventory using `docker system df`, falling back to
+// listing images, containers and volumes on older daemons.
+func (c *inventoryCollector) collect(ctx context.Context) (*inventory, error) {
+	var df diskUsage
+	err := c.api.getJSON(ctx, "/system/df", nil, &df)
+	if err == nil {
+		return df.inventory(), nil
+	}
+	if e, ok := err.(*daemonError); !ok || (e.StatusCode != http.StatusNotFound && e.StatusCode != http.StatusBadRequest) {
+		return nil, err
+	}
+	return c.list()
+}
+
+// list collects the inventory using the list APIs, which don't report sizes
+// of containers or volumes.
+func (c *inventoryCollector) list() (*inventory, error) {
+	inv := new(inventory)
+
+	images, err := c.client.ListImages(docker.ListImagesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		inv.Images++
+		inv.ImagesSize += image.Size
+		if dangling(image.RepoTags) {
+			inv.DanglingImages++
+			inv.DanglingImagesSize += image.Size
+		}
+	}
+
+	containers, err := c.client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"status": {"created", "exited", "dead"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	inv.StoppedContainers = len(containers)
+
+	volumes, err := c.client.ListVolumes(docker.ListVolumesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	inv.Volumes = len(volumes)
+
+	unused, err := c.client.ListVolumes(docker.ListVolumesOptions{
+		Filters: map[string][]string{"dangling": {"true"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	inv.UnusedVolumes = len(unused)
+
+	return inv, nil
+}
+
+// inventory summarizes the disk usage.
+func (df *diskUsage) inventory() *inventory {
+	inv := &inventory{
+		ImagesSize: df.LayersSize,
+		diskUsage:  true,
+	}
+
+	for _, image := range df.Images {
+		inv.Images++
+		if dangling(image.RepoTags) {
+			inv.DanglingImages++
+			inv.DanglingImagesSize += image.Size
+		}
+	}
+
+	for _, container := range df.Containers {
+		if container.State != "running" && container.State != "paused" && container.State != "restarting" {
+			inv.StoppedContainers++
+			inv.StoppedContainersSize += container.SizeRw
+		}
+	}
+
+	for _, volume := range df.Volumes {
+		inv.Volumes++
+		if volume.UsageData == nil {
+			continue
+		}
+		// The daemon reports -1 when the size couldn't be computed.
+		if volume.UsageData.Size > 0 {
+			inv.VolumesSize += volume.UsageData.Size
+		}
+		if volume.UsageData.RefCount == 0 {
+			inv.UnusedVolumes++
+			if volume.UsageData.Size > 0 {
+				inv.UnusedVolumesSize += volume.UsageData.Size
+			}
+		}
+	}
+
+	return inv
+}
+
+// dangling returns true if an image with the given tags is dangling.
+func dangling(tags []string) bool {
+	return len(tags) == 0 || (len(tags) == 1 && tags[0] == "<none>:<none>")
+}
+
+// reportInventory reports the inventory as gauges.
+func reportInventory(s Sink, inv *inventory) {
+	s.Gauge("docker.images.count", float64(inv.Images), nil, 1)
+	s.Gauge("docker.images.dangling.count", float64(inv.DanglingImages), nil, 1)
+	s.Gauge("docker.containers.stopped.count", float64(inv.StoppedContainers), nil, 1)
+	s.Gauge("docker.volumes.count", float64(inv.Volumes), nil, 1)
+	s.Gauge("docker.volumes.unused.count", float64(inv.UnusedVolumes), nil, 1)
+	s.Gauge("docker.images.size", float64(inv.ImagesSize), nil, 1)
+	s.Gauge("docker.images.dangling.size", float64(inv.DanglingImagesSize), nil, 1)
+
+	if inv.diskUsage {
+		s.Gauge("docker.containers.stopped.size", float64(inv.StoppedContainersSize), nil, 1)
+		s.Gauge("docker.volumes.size", float64(inv.VolumesSize), nil, 1)
+		s.Gauge("docker.volumes.unused.size", float64(inv.UnusedVolumesSize), nil, 1)
+	}
+}
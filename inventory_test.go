@@ -0,0 +1,64 @@
+package dockerdog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskUsage_Inventory(t *testing.T) {
+	var df diskUsage
+	err := json.Unmarshal([]byte(`{
+  "LayersSize": 5000,
+  "Images": [
+    {"Id": "sha256:a", "RepoTags": ["nginx:latest"], "Size": 3000},
+    {"Id": "sha256:b", "RepoTags": ["<none>:<none>"], "Size": 1000},
+    {"Id": "sha256:c", "RepoTags": null, "Size": 500}
+  ],
+  "Containers": [
+    {"Id": "1", "State": "running", "SizeRw": 10},
+    {"Id": "2", "State": "exited", "SizeRw": 20},
+    {"Id": "3", "State": "created", "SizeRw": 5}
+  ],
+  "Volumes": [
+    {"Name": "data", "UsageData": {"Size": 100, "RefCount": 1}},
+    {"Name": "old", "UsageData": {"Size": 50, "RefCount": 0}},
+    {"Name": "remote", "UsageData": {"Size": -1, "RefCount": 0}}
+  ]
+}`), &df)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &inventory{
+		Images:                3,
+		DanglingImages:        2,
+		ImagesSize:            5000,
+		DanglingImagesSize:    1500,
+		StoppedContainers:     2,
+		StoppedContainersSize: 25,
+		Volumes:               3,
+		UnusedVolumes:         2,
+		VolumesSize:           150,
+		UnusedVolumesSize:     50,
+		diskUsage:             true,
+	}, df.inventory())
+}
+
+func TestReportInventory(t *testing.T) {
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	reportInventory(s, &inventory{Images: 2, ImagesSize: 100, StoppedContainers: 1, Volumes: 1})
+
+	assert.Equal(t, []string{
+		"docker.containers.stopped.count:1.000000|g",
+		"docker.images.count:2.000000|g",
+		"docker.images.dangling.count:0.000000|g",
+		"docker.images.dangling.size:0.000000|g",
+		"docker.images.size:100.000000|g",
+		"docker.volumes.count:1.000000|g",
+		"docker.volumes.unused.count:0.000000|g",
+	}, packets(7))
+}
@@ -0,0 +1,121 @@
+package dockerdog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const defaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldConfig configures writing a record of each selected event to the
+// systemd journal, with the event's type, action, actor ID and tags as
+// fields.
+type JournaldConfig struct {
+	// Socket is the journal's socket, /run/systemd/journal/socket by
+	// default.
+	Socket string `json:"socket"`
+
+	// Events selects the events that are written, like
+	// SyslogConfig.Events. All events are written by default.
+	Events map[string][]string `json:"events"`
+
+	// Severity is the name of the syslog severity of records, info by
+	// default.
+	Severity string `json:"severity"`
+
+	// Identifier is the SYSLOG_IDENTIFIER of records, dockerdog by
+	// default.
+	Identifier string `json:"identifier"`
+}
+
+// validate returns an error if the journal is misconfigured.
+func (c *JournaldConfig) validate() error {
+	if _, ok := syslogSeverities[c.Severity]; c.Severity != "" && !ok {
+		return fmt.Errorf("unknown journald severity %q", c.Severity)
+	}
+	return nil
+}
+
+// journalWriter is an eventSink that writes a record of each selected event to
+// the systemd journal, using its native protocol. Each record has a
+// human-readable MESSAGE, and DOCKER_EVENT_TYPE, DOCKER_EVENT_ACTION,
+// DOCKER_ACTOR_ID and a DOCKER_TAG field for each tag. Records are written
+// with a recordWriter.
+type journalWriter struct {
+	*recordWriter
+	socket     string
+	events     map[string][]string
+	priority   int
+	identifier string
+}
+
+// newJournalWriter returns a journalWriter, and starts writing records. The
+// journal doesn't need to be running until the first record is written.
+func newJournalWriter(c JournaldConfig) (*journalWriter, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	severity := c.Severity
+	if severity == "" {
+		severity = defaultSyslogSeverity
+	}
+	w := &journalWriter{
+		socket:     c.Socket,
+		events:     c.Events,
+		priority:   syslogSeverities[severity],
+		identifier: c.Identifier,
+	}
+	if w.socket == "" {
+		w.socket = defaultJournaldSocket
+	}
+	if w.identifier == "" {
+		w.identifier = defaultSyslogAppName
+	}
+	w.recordWriter = newRecordWriter("the journal", "unixgram", w.socket, nil)
+	return w, nil
+}
+
+// send buffers a record of the event, if it's selected.
+func (w *journalWriter) send(event *docker.APIEvents, tags []string) {
+	if !selected(w.events, event) {
+		return
+	}
+	w.write(w.record(event, tags))
+}
+
+// record returns the record for the event, in the journal's native protocol.
+func (w *journalWriter) record(event *docker.APIEvents, tags []string) []byte {
+	action, _ := splitAction(event.Action)
+
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", eventMessage(event, tags))
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(w.priority))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", w.identifier)
+	writeJournalField(&b, "DOCKER_EVENT_TYPE", event.Type)
+	writeJournalField(&b, "DOCKER_EVENT_ACTION", action)
+	writeJournalField(&b, "DOCKER_ACTOR_ID", event.Actor.ID)
+	if event.TimeNano != 0 || event.Time != 0 {
+		writeJournalField(&b, "DOCKER_EVENT_TIMESTAMP", strconv.FormatInt(eventTime(event).UnixNano()/1000, 10))
+	}
+	for _, tag := range tags {
+		writeJournalField(&b, "DOCKER_TAG", tag)
+	}
+	return b.Bytes()
+}
+
+// writeJournalField writes a field in the journal's native protocol. Values
+// that contain newlines are written with their length, as binary.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
@@ -0,0 +1,61 @@
+package dockerdog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newJournalWriter(JournaldConfig{
+		Socket:   path,
+		Events:   map[string][]string{"container": nil},
+		Severity: "notice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range testAuditEvents() {
+		w.send(event, []string{"name:web", "cmd:echo\nsecret"})
+	}
+	assert.NoError(t, w.Close())
+
+	records := readDatagrams(conn)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	assert.Equal(t, "MESSAGE\n\x31\x00\x00\x00\x00\x00\x00\x00container exec_start abc cmd:echo\nsecret name:web\n"+
+		"PRIORITY=5\n"+
+		"SYSLOG_IDENTIFIER=dockerdog\n"+
+		"DOCKER_EVENT_TYPE=container\n"+
+		"DOCKER_EVENT_ACTION=exec_start\n"+
+		"DOCKER_ACTOR_ID=abc\n"+
+		"DOCKER_EVENT_TIMESTAMP=1500000000123456\n"+
+		"DOCKER_TAG=name:web\n"+
+		"DOCKER_TAG\n\x0f\x00\x00\x00\x00\x00\x00\x00cmd:echo\nsecret\n", records[0])
+	assert.Contains(t, records[1], "\nDOCKER_EVENT_ACTION=die\n")
+}
+
+func TestJournaldConfig_Validate(t *testing.T) {
+	c := JournaldConfig{Severity: "fatal"}
+	if err := c.validate(); assert.Error(t, err) {
+		assert.Equal(t, `unknown journald severity "fatal"`, err.Error())
+	}
+}
@@ -0,0 +1,140 @@
+package dockerdog
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// defaultLabelPrefix is the prefix of the labels that containers control
+// their reporting with, when not configured.
+const defaultLabelPrefix = "dockerdog"
+
+// LabelsConfig enables containers to control how they're reported with
+// labels:
+//
+//	dockerdog.ignore=true            ignores all events for the container
+//	dockerdog.tags=team:payments     adds tags to its metrics
+//	dockerdog.events=die,oom         only counts these actions
+type LabelsConfig struct {
+	// Prefix replaces "dockerdog" in the label names.
+	Prefix string `json:"prefix"`
+}
+
+// containerLabels reads the labels that control how a container is reported
+// from event attributes.
+type containerLabels struct {
+	ignore, tags, events string
+}
+
+func newContainerLabels(c LabelsConfig) *containerLabels {
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = defaultLabelPrefix
+	}
+	return &containerLabels{
+		ignore: prefix + ".ignore",
+		tags:   prefix + ".tags",
+		events: prefix + ".events",
+	}
+}
+
+// ignored returns true if the container has opted out of reporting.
+func (l *containerLabels) ignored(attributes map[string]string) bool {
+	ignore, _ := strconv.ParseBool(attributes[l.ignore])
+	return ignore
+}
+
+// tagsFor returns the tags that the container adds to its metrics.
+func (l *containerLabels) tagsFor(attributes map[string]string) []string {
+	var tags []string
+	for _, tag := range strings.Split(attributes[l.tags], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tagEscaper.Replace(tag))
+		}
+	}
+	return tags
+}
+
+// counts returns true if the container wants the action to be counted.
+func (l *containerLabels) counts(attributes map[string]string, action string) bool {
+	events, ok := attributes[l.events]
+	if !ok {
+		return true
+	}
+	for _, e := range strings.Split(events, ",") {
+		if strings.TrimSpace(e) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// labelProcessor adds the labels of containers to other events about them,
+// like network connects. The daemon only includes container labels in
+// container events, so the labels are cached by container.
+type labelProcessor struct {
+	labels *containerLabels
+
+	mu sync.Mutex
+	// containers maps the IDs of containers with any of the labels to
+	// their values.
+	containers map[string]map[string]string
+}
+
+func newLabelProcessor(labels *containerLabels) *labelProcessor {
+	return &labelProcessor{
+		labels:     labels,
+		containers: make(map[string]map[string]string),
+	}
+}
+
+// Process adds the labels of the event's container to it.
+func (p *labelProcessor) Process(event *docker.APIEvents) bool {
+	if event.Type == "container" {
+		p.remember(event)
+	} else if id := event.Actor.Attributes["container"]; id != "" {
+		p.mu.Lock()
+		labels := p.containers[id]
+		p.mu.Unlock()
+		for k, v := range labels {
+			if event.Actor.Attributes[k] == "" {
+				event.Actor.Attributes[k] = v
+			}
+		}
+	}
+	return true
+}
+
+// ignoreFilter drops the events of ignored containers.
+type ignoreFilter struct {
+	labels *containerLabels
+}
+
+// Process drops the event if its container is ignored.
+func (f *ignoreFilter) Process(event *docker.APIEvents) bool {
+	return !f.labels.ignored(event.Actor.Attributes)
+}
+
+// remember caches the labels of the container, until it's destroyed.
+func (p *labelProcessor) remember(event *docker.APIEvents) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if event.Action == "destroy" {
+		delete(p.containers, event.Actor.ID)
+		return
+	}
+
+	labels := make(map[string]string)
+	for _, k := range []string{p.labels.ignore, p.labels.tags, p.labels.events} {
+		if v, ok := event.Actor.Attributes[k]; ok {
+			labels[k] = v
+		}
+	}
+	if len(labels) > 0 {
+		p.containers[event.Actor.ID] = labels
+	}
+}
@@ -0,0 +1,70 @@
+package dockerdog
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "labels": {},
+  "events": {
+    "container": {
+      "actions": {
+        "start": {},
+        "die": {},
+        "oom": {}
+      }
+    },
+    "network": {
+      "actions": {
+        "connect": {}
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture := newFakeStatsd(t)
+	defer capture.Close()
+	s, err := NewStatsdSink(capture.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	source := &ReaderSource{Reader: strings.NewReader(`{"Type":"container","Action":"start","Actor":{"ID":"a","Attributes":{"dockerdog.ignore":"true"}}}
+{"Type":"network","Action":"connect","Actor":{"ID":"n","Attributes":{"container":"a"}}}
+{"Type":"container","Action":"die","Actor":{"ID":"a","Attributes":{"dockerdog.ignore":"true"}}}
+{"Type":"container","Action":"start","Actor":{"ID":"b","Attributes":{"dockerdog.tags":"team:payments, tier:1","dockerdog.events":"die,oom"}}}
+{"Type":"network","Action":"connect","Actor":{"ID":"n","Attributes":{"container":"b"}}}
+{"Type":"container","Action":"die","Actor":{"ID":"b","Attributes":{"dockerdog.tags":"team:payments, tier:1","dockerdog.events":"die,oom"}}}
+{"Type":"container","Action":"start","Actor":{"ID":"c","Attributes":{"dockerdog.ignore":"false"}}}
+`)}
+
+	w, err := NewWatcher(config, s, WithSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Run(context.Background()))
+
+	assert.Equal(t, []string{
+		"docker.events.container.die:1|c|#team:payments,tier:1",
+		"docker.events.container.start:1|c",
+	}, capture.packets())
+}
+
+func TestContainerLabels_Prefix(t *testing.T) {
+	l := newContainerLabels(LabelsConfig{Prefix: "com.example.metrics"})
+
+	assert.True(t, l.ignored(map[string]string{"com.example.metrics.ignore": "1"}))
+	assert.False(t, l.ignored(map[string]string{"dockerdog.ignore": "true"}))
+	assert.Equal(t, []string{"team:payments"}, l.tagsFor(map[string]string{"com.example.metrics.tags": "team:payments,"}))
+	assert.True(t, l.counts(map[string]string{}, "start"))
+	assert.False(t, l.counts(map[string]string{"com.example.metrics.events": "die"}, "start"))
+}
@@ -0,0 +1,150 @@
+package dockerdog
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Metric types that can be reported for a MetricConfig.
+const (
+	metricCount     = "count"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+	metricSet       = "set"
+	metricTiming    = "timing"
+)
+
+// Event fields that can be used as the value of a metric.
+const (
+	fieldID      = "id"
+	fieldType    = "type"
+	fieldAction  = "action"
+	fieldPayload = "payload"
+)
+
+// MetricConfig configures a custom metric, reported for the events that match
+// its trigger.
+type MetricConfig struct {
+	// Name of the metric, e.g. "docker.containers.exit_code".
+	Name string `json:"name"`
+
+	// Type of the metric: count, gauge, histogram, set or timing.
+	Type string `json:"type"`
+
+	// Event and Action trigger the metric. The metric is reported for any
+	// action of the event type when Action is empty.
+	Event  string `json:"event"`
+	Action string `json:"action"`
+
+	// When restricts the metric to events whose attributes match all of
+	// the conditions.
+	When []Condition `json:"when"`
+
+	// The value is read from Attribute or Field when set, or is Value,
+	// which defaults to 1. Field is one of id, type, action or payload.
+	// Timings are in milliseconds.
+	Value     *float64 `json:"value"`
+	Attribute string   `json:"attribute"`
+	Field     string   `json:"field"`
+
+	// Attributes configures the attributes that the metric should be
+	// tagged with.
+	Attributes map[string]bool `json:"attributes"`
+
+	// Tags are added to the metric, e.g. {"team": "payments"}.
+	Tags map[string]string `json:"tags"`
+}
+
+// validate returns an error if the metric is misconfigured.
+func (m *MetricConfig) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("metric name is required")
+	}
+	switch m.Type {
+	case metricCount, metricGauge, metricHistogram, metricSet, metricTiming:
+	default:
+		return fmt.Errorf("metric %s: unknown type %q", m.Name, m.Type)
+	}
+	if m.Event == "" {
+		return fmt.Errorf("metric %s: event is required", m.Name)
+	}
+	sources := 0
+	for _, set := range []bool{m.Value != nil, m.Attribute != "", m.Field != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("metric %s: only one of value, attribute and field can be set", m.Name)
+	}
+	switch m.Field {
+	case "", fieldID, fieldType, fieldAction, fieldPayload:
+	default:
+		return fmt.Errorf("metric %s: unknown field %q", m.Name, m.Field)
+	}
+	return nil
+}
+
+// matches returns true if the event triggers the metric.
+func (m *MetricConfig) matches(event *docker.APIEvents) bool {
+	if event.Type != m.Event {
+		return false
+	}
+	if action, _ := splitAction(event.Action); m.Action != "" && action != m.Action {
+		return false
+	}
+	return matchAll(m.When, event.Actor.Attributes)
+}
+
+// value returns the value of the metric for the event, and false if it's not
+// set.
+func (m *MetricConfig) value(event *docker.APIEvents) (string, bool) {
+	switch {
+	case m.Attribute != "":
+		v, ok := event.Actor.Attributes[m.Attribute]
+		return v, ok && v != ""
+	case m.Field != "":
+		action, payload := splitAction(event.Action)
+		v := map[string]string{
+			fieldID:      event.Actor.ID,
+			fieldType:    event.Type,
+			fieldAction:  action,
+			fieldPayload: payload,
+		}[m.Field]
+		return v, v != ""
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64), true
+	}
+	return "1", true
+}
+
+// reportMetric reports the metric for the event. Events without a value, or
+// whose value isn't a number for numeric metric types, are skipped.
+func reportMetric(s Sink, m *MetricConfig, event *docker.APIEvents, tags []string) {
+	v, ok := m.value(event)
+	if !ok {
+		return
+	}
+
+	if m.Type == metricSet {
+		s.Set(m.Name, v, tags, 1)
+		return
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return
+	}
+	switch m.Type {
+	case metricCount:
+		s.Count(m.Name, int64(f), tags, 1)
+	case metricGauge:
+		s.Gauge(m.Name, f, tags, 1)
+	case metricHistogram:
+		s.Histogram(m.Name, f, tags, 1)
+	case metricTiming:
+		s.TimeInMilliseconds(m.Name, f, tags, 1)
+	}
+}
@@ -0,0 +1,93 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter_Metrics(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "metrics": [
+    {
+      "name": "docker.containers.exit_code",
+      "type": "histogram",
+      "event": "container",
+      "action": "die",
+      "when": ["exitCode != 0"],
+      "attribute": "exitCode",
+      "attributes": {"image": true}
+    },
+    {
+      "name": "docker.images.started",
+      "type": "set",
+      "event": "container",
+      "action": "start",
+      "attribute": "image"
+    },
+    {
+      "name": "docker.containers.health",
+      "type": "gauge",
+      "event": "container",
+      "action": "health_status",
+      "when": ["name =~ ^web"],
+      "value": 0.5,
+      "tags": {"team": "payments"}
+    },
+    {
+      "name": "docker.containers.healthchecks",
+      "type": "set",
+      "event": "container",
+      "field": "payload"
+    },
+    {
+      "name": "docker.containers.events",
+      "type": "count",
+      "event": "container"
+    }
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	r := newReporter(config, s)
+	for _, event := range []*docker.APIEvents{
+		{Type: "container", Action: "start", Actor: docker.APIActor{Attributes: map[string]string{"image": "nginx"}}},
+		{Type: "container", Action: "health_status: healthy", Actor: docker.APIActor{Attributes: map[string]string{"name": "web"}}},
+		{Type: "container", Action: "die", Actor: docker.APIActor{Attributes: map[string]string{"image": "nginx", "exitCode": "0"}}},
+		{Type: "container", Action: "die", Actor: docker.APIActor{Attributes: map[string]string{"image": "nginx", "exitCode": "137"}}},
+		{Type: "image", Action: "pull"},
+	} {
+		r.Process(event)
+	}
+
+	assert.Equal(t, []string{
+		"docker.containers.events:1|c",
+		"docker.containers.events:1|c",
+		"docker.containers.events:1|c",
+		"docker.containers.events:1|c",
+		"docker.containers.exit_code:137.000000|h|#image:nginx",
+		"docker.containers.health:0.500000|g|#team:payments",
+		"docker.containers.healthchecks:healthy|s",
+		"docker.images.started:nginx|s",
+	}, packets(8))
+}
+
+func TestMetricConfig_Validate(t *testing.T) {
+	for _, raw := range []string{
+		`{"type": "count", "event": "container"}`,
+		`{"name": "a", "type": "meter", "event": "container"}`,
+		`{"name": "a", "type": "count"}`,
+		`{"name": "a", "type": "gauge", "event": "container", "value": 1, "attribute": "exitCode"}`,
+		`{"name": "a", "type": "set", "event": "container", "field": "time"}`,
+	} {
+		_, err := LoadConfig(strings.NewReader(`{"metrics": [` + raw + `]}`))
+		assert.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,261 @@
+package dockerdog
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultOTLPMetricsURL    = "http://localhost:4318/v1/metrics"
+	defaultOTLPServiceName   = "dockerdog"
+	defaultOTLPFlushInterval = 10 * time.Second
+	defaultOTLPBatchSize     = 1000
+
+	// otlpDelta is the delta aggregation temporality.
+	otlpDelta = 1
+)
+
+// OTLPConfig configures exporting to an OpenTelemetry collector over
+// OTLP/HTTP, with the JSON encoding.
+type OTLPConfig struct {
+	// URL is the endpoint that metrics are exported to.
+	URL string `json:"url"`
+
+	// ServiceName is the service.name resource attribute.
+	ServiceName string `json:"service_name"`
+
+	HTTPExportConfig
+}
+
+// otlpResource returns the resource that dockerdog reports as.
+func otlpResource(serviceName, host string) map[string]interface{} {
+	return map[string]interface{}{
+		"attributes": []otlpAttribute{
+			otlpString("service.name", serviceName),
+			otlpString("host.name", host),
+		},
+	}
+}
+
+// otlpScope is the instrumentation scope that dockerdog reports as.
+var otlpScope = map[string]interface{}{"name": "github.com/remind101/dockerdog"}
+
+// otlpAttribute is an attribute, with a string value.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// otlpAttributes returns the attributes for tags. Tags without a value have
+// an empty value.
+func otlpAttributes(tags []string) []otlpAttribute {
+	var attributes []otlpAttribute
+	for _, tag := range tags {
+		k, v := tagValue(tag)
+		attributes = append(attributes, otlpString(k, v))
+	}
+	return attributes
+}
+
+// otlpNanos returns t in nanoseconds, which OTLP/JSON encodes as a string.
+func otlpNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpDataPoint is a data point of a sum, gauge or histogram.
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+
+	// Histograms have a single bucket, since only the count, sum, min and
+	// max are aggregated.
+	Count          string    `json:"count,omitempty"`
+	Sum            *float64  `json:"sum,omitempty"`
+	Min            *float64  `json:"min,omitempty"`
+	Max            *float64  `json:"max,omitempty"`
+	BucketCounts   []string  `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64 `json:"explicitBounds,omitempty"`
+}
+
+// OTLPSink is a Sink that exports metrics to an OpenTelemetry collector.
+// Metrics are aggregated, and exported every flush interval: counts as delta
+// sums, gauges and sets as gauges, and histograms and timings as delta
+// histograms. Service checks are gauges of their status. OTLP metrics have no
+// equivalent of events, so they're dropped.
+type OTLPSink struct {
+	*batchingSink
+	client   *retryingClient
+	url      string
+	headers  headerTemplates
+	resource map[string]interface{}
+	host     string
+}
+
+// NewOTLPSink returns an OTLPSink, and starts exporting metrics.
+func NewOTLPSink(c OTLPConfig) (*OTLPSink, error) {
+	headers, err := parseHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	e := c.HTTPExportConfig.defaults(defaultOTLPFlushInterval, defaultOTLPBatchSize)
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = defaultOTLPServiceName
+	}
+
+	s := &OTLPSink{
+		client:  newRetryingClient(e.MaxRetries),
+		url:     c.URL,
+		headers: headers,
+	}
+	if s.url == "" {
+		s.url = defaultOTLPMetricsURL
+	}
+	s.host, _ = os.Hostname()
+	s.resource = otlpResource(serviceName, s.host)
+	s.batchingSink = newBatchingSink(e.FlushInterval.Duration, e.BatchSize, s.sendBatch)
+	return s, nil
+}
+
+// otlpPoint is a data point, and the metric it belongs to.
+type otlpPoint struct {
+	kind, name string
+	point      otlpDataPoint
+}
+
+// sendBatch exports a batch of metrics and service checks. Errors are logged,
+// and the metrics that couldn't be exported are dropped.
+func (s *OTLPSink) sendBatch(b *batch) {
+	var points []otlpPoint
+	for key, p := range b.series {
+		start := time.Unix(key.timestamp, 0)
+		point := otlpDataPoint{
+			Attributes:   otlpAttributes(p.tags),
+			TimeUnixNano: otlpNanos(start.Add(time.Second)),
+		}
+		kind := key.kind
+		switch kind {
+		case seriesCount:
+			point.StartTimeUnixNano = otlpNanos(start)
+			point.AsDouble = &p.value
+		case seriesDistribution:
+			point.StartTimeUnixNano = otlpNanos(start)
+			sum, min, max := summarize(p.values)
+			count := strconv.Itoa(len(p.values))
+			point.Count, point.Sum, point.Min, point.Max = count, &sum, &min, &max
+			point.BucketCounts = []string{count}
+		case seriesSet:
+			kind = seriesGauge
+			n := float64(len(p.set))
+			point.AsDouble = &n
+		default:
+			point.AsDouble = &p.value
+		}
+		points = append(points, otlpPoint{kind, key.name, point})
+	}
+
+	for _, c := range b.checks {
+		status := float64(c.check.Status)
+		t := c.t
+		if t.IsZero() {
+			t = time.Now()
+		}
+		points = append(points, otlpPoint{seriesGauge, c.check.Name, otlpDataPoint{
+			Attributes:   otlpAttributes(c.check.Tags),
+			TimeUnixNano: otlpNanos(t),
+			AsDouble:     &status,
+		}})
+	}
+
+	// Points are grouped into metrics by name, so that each request has
+	// as few metrics as possible.
+	sort.Sort(otlpPoints(points))
+	split(len(points), s.batchSize, func(i, j int) {
+		if err := s.export(points[i:j]); err != nil {
+			log.Printf("error exporting metrics over OTLP: %v", err)
+		}
+	})
+}
+
+// export exports the points, which are sorted by metric.
+func (s *OTLPSink) export(points []otlpPoint) error {
+	var metrics []map[string]interface{}
+	for i := 0; i < len(points); {
+		j := i + 1
+		for j < len(points) && points[j].kind == points[i].kind && points[j].name == points[i].name {
+			j++
+		}
+		var dataPoints []otlpDataPoint
+		for _, p := range points[i:j] {
+			dataPoints = append(dataPoints, p.point)
+		}
+
+		metric := map[string]interface{}{"name": points[i].name}
+		switch points[i].kind {
+		case seriesCount:
+			metric["sum"] = map[string]interface{}{
+				"dataPoints":             dataPoints,
+				"aggregationTemporality": otlpDelta,
+				"isMonotonic":            true,
+			}
+		case seriesDistribution:
+			metric["histogram"] = map[string]interface{}{
+				"dataPoints":             dataPoints,
+				"aggregationTemporality": otlpDelta,
+			}
+		default:
+			metric["gauge"] = map[string]interface{}{"dataPoints": dataPoints}
+		}
+		metrics = append(metrics, metric)
+		i = j
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": s.resource,
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   otlpScope,
+				"metrics": metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.client.post(s.url, body, func() (http.Header, error) {
+		h := http.Header{"Content-Type": {"application/json"}}
+		if err := s.headers.render(h, s.host); err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+}
+
+// otlpPoints sorts points by metric.
+type otlpPoints []otlpPoint
+
+func (p otlpPoints) Len() int      { return len(p) }
+func (p otlpPoints) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p otlpPoints) Less(i, j int) bool {
+	if p[i].name != p[j].name {
+		return p[i].name < p[j].name
+	}
+	return p[i].kind < p[j].kind
+}
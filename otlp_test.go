@@ -0,0 +1,116 @@
+package dockerdog
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPSink(t *testing.T) {
+	collector := newFakeWebhook()
+	defer collector.Close()
+
+	os.Setenv("DOCKERDOG_TEST_OTLP_KEY", "secret")
+	defer os.Unsetenv("DOCKERDOG_TEST_OTLP_KEY")
+
+	s, err := NewOTLPSink(OTLPConfig{
+		URL:         collector.URL + "/v1/metrics",
+		ServiceName: "docker-events",
+		HTTPExportConfig: HTTPExportConfig{
+			Headers: map[string]string{"X-Api-Key": `{{env "DOCKERDOG_TEST_OTLP_KEY"}}`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.host = "web-1"
+	s.resource = otlpResource("docker-events", s.host)
+
+	at := s.At(time.Unix(1500000000, 0))
+	at.Count("docker.events.container.die", 1, []string{"name:web"}, 1)
+	at.Count("docker.events.container.die", 2, []string{"name:web"}, 1)
+	at.Count("docker.events.container.die", 1, []string{"name:db"}, 1)
+	at.Set("docker.images", "redis", nil, 1)
+	at.Histogram("docker.container.exit_code", 137, nil, 1)
+	at.Histogram("docker.container.exit_code", 1, nil, 1)
+	at.ServiceCheck(&ServiceCheck{Name: "docker.container.health", Status: ServiceCheckCritical, Tags: []string{"canary"}})
+	at.Event(statsd.NewEvent("web is crash looping", "web died"))
+	assert.NoError(t, s.Close())
+
+	requests, bodies := collector.received()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	assert.Equal(t, "/v1/metrics", requests[0].URL.Path)
+	assert.Equal(t, "application/json", requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "secret", requests[0].Header.Get("X-Api-Key"))
+
+	var body struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeMetrics []struct {
+				Metrics []map[string]json.RawMessage `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	rm := body.ResourceMetrics[0]
+	assert.Equal(t, []otlpAttribute{otlpString("service.name", "docker-events"), otlpString("host.name", "web-1")}, rm.Resource.Attributes)
+
+	metrics := make(map[string]string)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		var name string
+		json.Unmarshal(m["name"], &name)
+		for k, v := range m {
+			if k != "name" {
+				metrics[name+" "+k] = string(v)
+			}
+		}
+	}
+
+	assert.Len(t, metrics, 4)
+	assertJSON(t, `{"aggregationTemporality": 1, "isMonotonic": true, "dataPoints": [
+  {"attributes": [{"key": "name", "value": {"stringValue": "db"}}], "startTimeUnixNano": "1500000000000000000", "timeUnixNano": "1500000001000000000", "asDouble": 1},
+  {"attributes": [{"key": "name", "value": {"stringValue": "web"}}], "startTimeUnixNano": "1500000000000000000", "timeUnixNano": "1500000001000000000", "asDouble": 3}
+]}`, sortDataPoints(t, metrics["docker.events.container.die sum"]))
+	assertJSON(t, `{"dataPoints": [
+  {"timeUnixNano": "1500000001000000000", "asDouble": 1}
+]}`, metrics["docker.images gauge"])
+	assertJSON(t, `{"aggregationTemporality": 1, "dataPoints": [
+  {"startTimeUnixNano": "1500000000000000000", "timeUnixNano": "1500000001000000000", "count": "2", "sum": 138, "min": 1, "max": 137, "bucketCounts": ["2"]}
+]}`, metrics["docker.container.exit_code histogram"])
+	assertJSON(t, `{"dataPoints": [
+  {"attributes": [{"key": "canary", "value": {"stringValue": ""}}], "timeUnixNano": "1500000000000000000", "asDouble": 2}
+]}`, metrics["docker.container.health gauge"])
+}
+
+// sortDataPoints sorts the data points of a metric by their attributes, since
+// they're exported in no particular order.
+func sortDataPoints(t *testing.T, metric string) string {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(metric), &m); err != nil {
+		t.Fatal(err)
+	}
+	points := m["dataPoints"].([]interface{})
+	key := func(i int) string {
+		b, _ := json.Marshal(points[i].(map[string]interface{})["attributes"])
+		return string(b)
+	}
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			if key(j) < key(i) {
+				points[i], points[j] = points[j], points[i]
+			}
+		}
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
@@ -0,0 +1,107 @@
+package dockerdog
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// eventSink receives each reported event, with the tags that it's counted
+// with, unlike a Sink, which receives metrics.
+type eventSink interface {
+	send(event *docker.APIEvents, tags []string)
+
+	// Close sends anything that's buffered, and releases resources.
+	Close() error
+}
+
+// selected returns true if the event is selected by events, which maps event
+// types to actions, e.g. {"container": ["start", "die"]}. A type without
+// actions selects all of its actions, and no types selects all events.
+func selected(events map[string][]string, event *docker.APIEvents) bool {
+	if len(events) == 0 {
+		return true
+	}
+	actions, ok := events[event.Type]
+	if !ok {
+		return false
+	}
+	if len(actions) == 0 {
+		return true
+	}
+	action, _ := splitAction(event.Action)
+	return contains(actions, action)
+}
+
+// newEventSinks returns the event sinks that receive reported events, which are
+// configured by c.
+func newEventSinks(c *Config) ([]eventSink, error) {
+	var sinks []eventSink
+	fail := func(err error) ([]eventSink, error) {
+		closeEventSinks(sinks)
+		return nil, err
+	}
+
+	for _, wc := range c.Webhooks {
+		s, err := newWebhook(wc)
+		if err != nil {
+			return fail(fmt.Errorf("error configuring webhook %s: %v", wc.URL, err))
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// newAuditLogs returns the audit logs configured by c, which are event sinks
+// that receive every event.
+func newAuditLogs(c *Config) ([]eventSink, error) {
+	var sinks []eventSink
+	fail := func(err error) ([]eventSink, error) {
+		closeEventSinks(sinks)
+		return nil, err
+	}
+
+	for _, sc := range c.Syslog {
+		s, err := newSyslogWriter(sc)
+		if err != nil {
+			return fail(fmt.Errorf("error configuring syslog %s: %v", sc.Address, err))
+		}
+		sinks = append(sinks, s)
+	}
+	if c.Journald != nil {
+		j, err := newJournalWriter(*c.Journald)
+		if err != nil {
+			return fail(fmt.Errorf("error configuring journald: %v", err))
+		}
+		sinks = append(sinks, j)
+	}
+	return sinks, nil
+}
+
+// eventTap is a Processor that sends every event to the event sinks that must
+// see them all, like audit logs and traces, before container labels, filters
+// or later processors can drop it.
+type eventTap struct {
+	reporter *reporter
+	sinks    []eventSink
+}
+
+// Process sends the event to the sinks, with the tags that it's reported
+// with.
+func (t *eventTap) Process(event *docker.APIEvents) bool {
+	tags := t.reporter.tags(event)
+	for _, s := range t.sinks {
+		s.send(event, tags)
+	}
+	return true
+}
+
+// closeEventSinks closes the sinks, and logs any errors.
+func closeEventSinks(sinks []eventSink) {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("error closing event sink: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package dockerdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultPayloadTag is the name of the tag that payloads are reported
+	// as, when not configured.
+	defaultPayloadTag = "payload"
+
+	// redacted replaces the parts of a payload that match a redact
+	// pattern.
+	redacted = "[REDACTED]"
+)
+
+// PayloadConfig configures how the payload of an action is reported. Newer
+// daemons include a payload in some actions, like the command in
+// `exec_start: /bin/sh -c curl localhost` or the status in
+// `health_status: unhealthy`.
+type PayloadConfig struct {
+	// Tag is the name of the tag to report the payload as.
+	Tag string `json:"tag"`
+
+	// Redact is a list of patterns. Parts of the payload that match any
+	// of them are replaced with [REDACTED].
+	Redact []Pattern `json:"redact"`
+
+	// Transform rewrites the payload after it's been redacted, e.g. to
+	// only keep the name of the command that was executed.
+	Transform *struct {
+		// Pattern matches the parts of the payload to rewrite.
+		Pattern Pattern `json:"pattern"`
+
+		// Replacement replaces each match, and can refer to
+		// submatches with $1 or ${name}.
+		Replacement string `json:"replacement"`
+	} `json:"transform"`
+
+	// MaxLength truncates the payload to this many bytes when greater
+	// than 0.
+	MaxLength int `json:"max_length"`
+}
+
+// tag returns the tag to report the payload as.
+func (c *PayloadConfig) tag(payload string) string {
+	for _, p := range c.Redact {
+		payload = p.ReplaceAllString(payload, redacted)
+	}
+
+	if c.Transform != nil && c.Transform.Pattern.Regexp != nil {
+		payload = c.Transform.Pattern.ReplaceAllString(payload, c.Transform.Replacement)
+	}
+
+	if c.MaxLength > 0 && len(payload) > c.MaxLength {
+		payload = payload[:c.MaxLength]
+	}
+
+	name := c.Tag
+	if name == "" {
+		name = defaultPayloadTag
+	}
+
+	return fmt.Sprintf("%s:%s", name, tagEscaper.Replace(payload))
+}
+
+// tagEscaper replaces the characters that have special meaning in the
+// DogStatsD protocol, and can't appear in a tag.
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "\n", " ")
+
+// splitAction splits an action into its base action and payload, e.g.
+// `exec_start: /bin/sh -c date` is split into `exec_start` and
+// `/bin/sh -c date`.
+func splitAction(action string) (string, string) {
+	i := strings.Index(action, ":")
+	if i < 0 {
+		return action, ""
+	}
+	return action[:i], strings.TrimSpace(action[i+1:])
+}
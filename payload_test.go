@@ -0,0 +1,60 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAction(t *testing.T) {
+	tests := []struct {
+		action, base, payload string
+	}{
+		{"start", "start", ""},
+		{"health_status: unhealthy", "health_status", "unhealthy"},
+		{"exec_start: /bin/sh -c curl localhost:8080", "exec_start", "/bin/sh -c curl localhost:8080"},
+	}
+
+	for _, tt := range tests {
+		base, payload := splitAction(tt.action)
+		assert.Equal(t, tt.base, base)
+		assert.Equal(t, tt.payload, payload)
+	}
+}
+
+func TestPayloadConfig_Tag(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "events": {
+    "container": {
+      "actions": {
+        "health_status": {
+          "payload": {}
+        },
+        "exec_start": {
+          "payload": {
+            "tag": "command",
+            "redact": ["--password[= ]\\S+"],
+            "transform": {
+              "pattern": "^/bin/sh -c (.*)$",
+              "replacement": "$1"
+            },
+            "max_length": 32
+          }
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, config.payload("container", "start"))
+	assert.Equal(t, "payload:unhealthy", config.payload("container", "health_status").tag("unhealthy"))
+
+	p := config.payload("container", "exec_start")
+	assert.Equal(t, "command:mysql [REDACTED]", p.tag("/bin/sh -c mysql --password hunter2"))
+	assert.Equal(t, "command:curl a_b", p.tag("curl a,b"))
+	assert.Equal(t, "command:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", p.tag(strings.Repeat("a", 40)))
+}
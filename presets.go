@@ -0,0 +1,25 @@
+package dockerdog
+
+// presets maps the name of each preset to the well-known labels that it
+// includes, and the tags that they're reported as. Tag names match the ones
+// used by the Datadog agent.
+var presets = map[string]map[string]string{
+	"compose": {
+		"com.docker.compose.project": "compose_project",
+		"com.docker.compose.service": "compose_service",
+	},
+	"kubernetes": {
+		"io.kubernetes.pod.namespace":  "kube_namespace",
+		"io.kubernetes.pod.name":       "pod_name",
+		"io.kubernetes.container.name": "kube_container_name",
+	},
+	"ecs": {
+		"com.amazonaws.ecs.cluster":                "ecs_cluster_name",
+		"com.amazonaws.ecs.task-definition-family": "task_family",
+		"com.amazonaws.ecs.container-name":         "ecs_container_name",
+	},
+	"swarm": {
+		"com.docker.swarm.service.name": "swarm_service",
+		"com.docker.stack.namespace":    "swarm_namespace",
+	},
+}
@@ -0,0 +1,167 @@
+package dockerdog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// defaultQueueSize and defaultQueueWorkers are used when the queue
+	// config omits size or workers.
+	defaultQueueSize    = 1000
+	defaultQueueWorkers = 1
+
+	// queueInterval is how often the dockerdog.queue.depth gauge is
+	// reported.
+	queueInterval = 10 * time.Second
+)
+
+// Policies for when the queue is full.
+const (
+	queueBlock      = "block"
+	queueDropOldest = "drop_oldest"
+	queueDropNewest = "drop_newest"
+)
+
+// QueueConfig configures a bounded queue between the event source and the
+// processors, so that slow processors or sinks don't hold up the source.
+type QueueConfig struct {
+	// Size is the number of events that can be queued, split evenly
+	// between the workers.
+	Size int `json:"size"`
+
+	// Workers is the number of events processed concurrently. Events for
+	// the same container are always processed in order, by the same
+	// worker.
+	Workers int `json:"workers"`
+
+	// Policy is what happens to new events when the queue is full: block
+	// (the default) waits for room, drop_oldest drops the oldest queued
+	// event, and drop_newest drops the new event.
+	Policy string `json:"policy"`
+}
+
+// validate returns an error if the queue is misconfigured.
+func (c *QueueConfig) validate() error {
+	switch c.Policy {
+	case "", queueBlock, queueDropOldest, queueDropNewest:
+		return nil
+	}
+	return fmt.Errorf("unknown queue policy %q", c.Policy)
+}
+
+// eventQueue is a bounded queue of events, processed by workers. Each worker
+// has its own queue, and events are assigned to workers by container, so that
+// they're processed in order.
+type eventQueue struct {
+	sink   Sink
+	policy string
+	queues []chan *docker.APIEvents
+	wg     sync.WaitGroup
+}
+
+// newEventQueue returns a queue, and starts its workers, which call process
+// for each event.
+func newEventQueue(config QueueConfig, s Sink, process func(*docker.APIEvents)) *eventQueue {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	size := config.Size
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	perWorker := size / workers
+	if perWorker < 1 {
+		perWorker = 1
+	}
+
+	q := &eventQueue{
+		sink:   s,
+		policy: config.Policy,
+		queues: make([]chan *docker.APIEvents, workers),
+	}
+	if q.policy == "" {
+		q.policy = queueBlock
+	}
+	for i := range q.queues {
+		events := make(chan *docker.APIEvents, perWorker)
+		q.queues[i] = events
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for event := range events {
+				process(event)
+			}
+		}()
+	}
+	return q
+}
+
+// push queues the event, applying the policy if the queue is full. push must
+// not be called concurrently, or after close.
+func (q *eventQueue) push(event *docker.APIEvents) {
+	events := q.queues[q.worker(event)]
+
+	switch q.policy {
+	case queueDropNewest:
+		select {
+		case events <- event:
+		default:
+			q.dropped()
+		}
+	case queueDropOldest:
+		for {
+			select {
+			case events <- event:
+				return
+			default:
+			}
+			select {
+			case <-events:
+				q.dropped()
+			default:
+				// The worker made room.
+			}
+		}
+	default:
+		events <- event
+	}
+}
+
+// worker returns the index of the worker for the event's container.
+func (q *eventQueue) worker(event *docker.APIEvents) int {
+	id := event.Actor.ID
+	if id == "" {
+		id = event.ID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(q.queues)))
+}
+
+// dropped reports that an event was dropped.
+func (q *eventQueue) dropped() {
+	q.sink.Count("dockerdog.queue.dropped", 1, []string{fmt.Sprintf("policy:%s", q.policy)}, 1)
+}
+
+// reportDepth reports the number of queued events.
+func (q *eventQueue) reportDepth() {
+	depth := 0
+	for _, events := range q.queues {
+		depth += len(events)
+	}
+	q.sink.Gauge("dockerdog.queue.depth", float64(depth), nil, 1)
+}
+
+// close waits for the queued events to be processed, and stops the workers.
+func (q *eventQueue) close() {
+	for _, events := range q.queues {
+		close(events)
+	}
+	q.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package dockerdog
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventQueue_Ordering(t *testing.T) {
+	s, _ := newTestStatsd(t)
+	defer s.Close()
+
+	var (
+		mu  sync.Mutex
+		got = make(map[string][]string)
+	)
+	q := newEventQueue(QueueConfig{Workers: 4}, s, func(event *docker.APIEvents) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[event.Actor.ID] = append(got[event.Actor.ID], event.Action)
+	})
+
+	actions := []string{"create", "start", "die", "destroy"}
+	for _, action := range actions {
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			q.push(&docker.APIEvents{Action: action, Actor: docker.APIActor{ID: id}})
+		}
+	}
+	q.close()
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		assert.Equal(t, actions, got[id], id)
+	}
+}
+
+func TestEventQueue_DropPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		got    []string
+	}{
+		{queueDropNewest, []string{"1", "2"}},
+		{queueDropOldest, []string{"3", "4"}},
+	}
+
+	for _, tt := range tests {
+		s, packets := newTestStatsd(t)
+
+		var got []string
+		started, block := make(chan bool), make(chan bool)
+		q := newEventQueue(QueueConfig{Size: 2, Policy: tt.policy}, s, func(event *docker.APIEvents) {
+			if event.Action == "0" {
+				started <- true
+				<-block
+				return
+			}
+			got = append(got, event.Action)
+		})
+
+		// The worker is blocked on the first event, so the queue
+		// fills up.
+		q.push(&docker.APIEvents{Action: "0"})
+		<-started
+		for _, action := range []string{"1", "2", "3", "4"} {
+			q.push(&docker.APIEvents{Action: action})
+		}
+		q.reportDepth()
+		close(block)
+		q.close()
+
+		assert.Equal(t, tt.got, got, tt.policy)
+		assert.Equal(t, []string{
+			"dockerdog.queue.depth:2.000000|g",
+			"dockerdog.queue.dropped:1|c|#policy:" + tt.policy,
+			"dockerdog.queue.dropped:1|c|#policy:" + tt.policy,
+		}, packets(3), tt.policy)
+		s.Close()
+	}
+}
+
+func TestQueueConfig_Validate(t *testing.T) {
+	_, err := LoadConfig(strings.NewReader(`{"queue": {"policy": "drop_oldest"}}`))
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(strings.NewReader(`{"queue": {"policy": "drop_random"}}`))
+	assert.EqualError(t, err, `unknown queue policy "drop_random"`)
+}
@@ -0,0 +1,165 @@
+package dockerdog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// reporter is the last Processor of a Watcher, which reports Docker events
+// to a Sink.
+type reporter struct {
+	config *Config
+	sink   Sink
+
+	// crashLoops is nil when crash loop detection is disabled.
+	crashLoops *crashLoopDetector
+
+	// stats is nil when stats collection is disabled.
+	stats *statsCollector
+
+	// labels is nil when containers can't control how they're reported
+	// with labels.
+	labels *containerLabels
+
+	// outputs receive each reported event.
+	outputs []eventSink
+}
+
+func newReporter(config *Config, s Sink) *reporter {
+	r := &reporter{
+		config: config,
+		sink:   s,
+	}
+	if config.CrashLoop != nil {
+		r.crashLoops = newCrashLoopDetector(*config.CrashLoop)
+	}
+	if config.Labels != nil {
+		r.labels = newContainerLabels(*config.Labels)
+	}
+	return r
+}
+
+// Process increments the counter for the event, if the event type is being
+// tracked, and the event matches the action's conditions. Custom metrics are
+// reported for the event if it triggers them, and it's sent to the outputs.
+// Sinks that support timestamps report them when the event happened.
+func (r *reporter) Process(event *docker.APIEvents) bool {
+	sink := r.sink
+	if event.TimeNano != 0 || event.Time != 0 {
+		sink = sinkAt(sink, eventTime(event))
+	}
+
+	if r.crashLoops != nil {
+		if service, ok := r.crashLoops.observe(event); ok {
+			r.reportCrashLoop(sink, service)
+		}
+	}
+
+	if r.stats != nil {
+		r.stats.handle(event)
+	}
+
+	if r.config.ServiceChecks != nil {
+		if sc := healthCheck(event, r.tags(event)); sc != nil {
+			sink.ServiceCheck(sc)
+		}
+	}
+
+	action, _ := splitAction(event.Action)
+	if r.labels != nil && !r.labels.counts(event.Actor.Attributes, action) {
+		return true
+	}
+
+	tags := r.tags(event)
+	for _, o := range r.outputs {
+		o.send(event, tags)
+	}
+
+	if _, ok := r.config.Events[event.Type]; ok && matchAll(r.config.conditions(event.Type, action), event.Actor.Attributes) {
+		sink.Count(fmt.Sprintf("docker.events.%s.%s", event.Type, action), 1, tags, 1)
+	}
+
+	for i := range r.config.Metrics {
+		if m := &r.config.Metrics[i]; m.matches(event) {
+			reportMetric(sink, m, event, r.metricTags(m, event))
+		}
+	}
+	return true
+}
+
+// tags returns the tags for the enabled attributes of the event, its payload
+// if configured, and the tags of any rules that it matches.
+func (r *reporter) tags(event *docker.APIEvents) []string {
+	action, payload := splitAction(event.Action)
+	enabledAttributes := r.config.attributes(event.Type, action)
+
+	var tags []string
+	for k, v := range event.Actor.Attributes {
+		if enabledAttributes[k] {
+			tags = append(tags, fmt.Sprintf("%s:%s", r.config.tag(k), v))
+		}
+	}
+
+	if p := r.config.payload(event.Type, action); p != nil && payload != "" {
+		tags = append(tags, p.tag(payload))
+	}
+
+	for _, rule := range r.config.rules(event.Type, action) {
+		if matchAll(rule.When, event.Actor.Attributes) {
+			for k, v := range rule.Tags {
+				tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+			}
+		}
+	}
+
+	if r.labels != nil {
+		tags = append(tags, r.labels.tagsFor(event.Actor.Attributes)...)
+	}
+
+	return tags
+}
+
+// metricTags returns the tags for a custom metric.
+func (r *reporter) metricTags(m *MetricConfig, event *docker.APIEvents) []string {
+	var tags []string
+	for k, v := range event.Actor.Attributes {
+		if m.Attributes[k] {
+			tags = append(tags, fmt.Sprintf("%s:%s", r.config.tag(k), v))
+		}
+	}
+	for k, v := range m.Tags {
+		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	}
+	if r.labels != nil {
+		tags = append(tags, r.labels.tagsFor(event.Actor.Attributes)...)
+	}
+	return tags
+}
+
+// reportCrashLoop reports that service has started crash looping to s.
+func (r *reporter) reportCrashLoop(s Sink, service string) {
+	tags := []string{fmt.Sprintf("service:%s", service)}
+	s.Count("docker.crash_loop.detected", 1, tags, 1)
+
+	if r.config.CrashLoop.Event {
+		e := statsd.NewEvent(
+			fmt.Sprintf("%s is crash looping", service),
+			fmt.Sprintf("%s died more than %d times within %v.", service, r.crashLoops.restarts, r.crashLoops.window),
+		)
+		e.AlertType = statsd.Error
+		e.AggregationKey = fmt.Sprintf("crash_loop:%s", service)
+		e.SourceTypeName = "docker"
+		e.Tags = tags
+		s.Event(e)
+	}
+}
+
+// reportCrashLoops reports the number of services that are currently crash
+// looping.
+func (r *reporter) reportCrashLoops(now time.Time) {
+	n := r.crashLoops.expire(now)
+	r.sink.Gauge("docker.crash_loop.active", float64(n), nil, 1)
+}
@@ -0,0 +1,142 @@
+package dockerdog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// RouteConfig sends the metrics, events and service checks whose tags match
+// its conditions to a sink.
+type RouteConfig struct {
+	// When matches the tags of each metric, e.g. ["team == payments"].
+	// Tags without a value, like "canary", have an empty value. A route
+	// without conditions matches everything.
+	When []Condition `json:"when"`
+
+	// Sink is where matching metrics are sent.
+	Sink SinkConfig `json:"sink"`
+}
+
+// route is a RouteConfig, and its sink.
+type route struct {
+	when []Condition
+	sink Sink
+}
+
+// Router is a Sink that sends each metric to the sinks of all of the routes
+// that match its tags, or to a fallback sink if none match.
+type Router struct {
+	routes   []route
+	fallback Sink
+}
+
+// NewRouter returns a Router for the routes, which sends metrics that don't
+// match any route to fallback. Closing the router closes all of the sinks,
+// including fallback.
+func NewRouter(fallback Sink, routes []RouteConfig) (*Router, error) {
+	r := &Router{fallback: fallback}
+	for _, c := range routes {
+		s, err := NewSink(c.Sink)
+		if err != nil {
+			for _, route := range r.routes {
+				route.sink.Close()
+			}
+			return nil, err
+		}
+		r.routes = append(r.routes, route{when: c.When, sink: s})
+	}
+	return r, nil
+}
+
+// At returns a Router that reports to each sink at t, if it supports
+// timestamps. It must not be closed.
+func (r *Router) At(t time.Time) Sink {
+	at := &Router{fallback: sinkAt(r.fallback, t)}
+	for _, route := range r.routes {
+		route.sink = sinkAt(route.sink, t)
+		at.routes = append(at.routes, route)
+	}
+	return at
+}
+
+// sinks returns the sinks for a metric with the given tags.
+func (r *Router) sinks(tags []string) []Sink {
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		k, v := tagValue(tag)
+		values[k] = v
+	}
+
+	var sinks []Sink
+	for _, route := range r.routes {
+		if matchAll(route.when, values) {
+			sinks = append(sinks, route.sink)
+		}
+	}
+	if len(sinks) == 0 {
+		sinks = append(sinks, r.fallback)
+	}
+	return sinks
+}
+
+// each calls f for each sink of a metric, and returns the first error.
+func (r *Router) each(tags []string, f func(Sink) error) error {
+	var err error
+	for _, s := range r.sinks(tags) {
+		if serr := f(s); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func (r *Router) Count(name string, value int64, tags []string, rate float64) error {
+	return r.each(tags, func(s Sink) error { return s.Count(name, value, tags, rate) })
+}
+
+func (r *Router) Gauge(name string, value float64, tags []string, rate float64) error {
+	return r.each(tags, func(s Sink) error { return s.Gauge(name, value, tags, rate) })
+}
+
+func (r *Router) Histogram(name string, value float64, tags []string, rate float64) error {
+	return r.each(tags, func(s Sink) error { return s.Histogram(name, value, tags, rate) })
+}
+
+func (r *Router) Set(name string, value string, tags []string, rate float64) error {
+	return r.each(tags, func(s Sink) error { return s.Set(name, value, tags, rate) })
+}
+
+func (r *Router) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	return r.each(tags, func(s Sink) error { return s.TimeInMilliseconds(name, value, tags, rate) })
+}
+
+func (r *Router) Event(e *statsd.Event) error {
+	return r.each(e.Tags, func(s Sink) error { return s.Event(e) })
+}
+
+func (r *Router) ServiceCheck(sc *ServiceCheck) error {
+	return r.each(sc.Tags, func(s Sink) error { return s.ServiceCheck(sc) })
+}
+
+// Close closes all of the sinks, and returns the first error.
+func (r *Router) Close() error {
+	err := r.fallback.Close()
+	for _, route := range r.routes {
+		if cerr := route.sink.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// tagValue splits a "key:value" tag. Tags without a colon have an empty
+// value.
+func tagValue(tag string) (string, string) {
+	i := strings.Index(tag, ":")
+	if i < 0 {
+		return tag, ""
+	}
+	return tag[:i], tag[i+1:]
+}
@@ -0,0 +1,54 @@
+package dockerdog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	fallback, payments, prod := newFakeStatsd(t), newFakeStatsd(t), newFakeStatsd(t)
+	defer fallback.Close()
+	defer payments.Close()
+	defer prod.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "routes": [
+    {"when": ["team == payments"], "sink": {"statsd": "` + payments.Addr() + `"}},
+    {"when": ["environment =~ ^prod", "team == payments"], "sink": {"statsd": "` + prod.Addr() + `"}}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStatsdSink(fallback.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRouter(s, config.Routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Count("a", 1, []string{"team:payments"}, 1)
+	r.Count("b", 1, []string{"team:payments", "environment:production", "canary"}, 1)
+	r.Gauge("c", 1, []string{"environment:production"}, 1)
+	r.Event(statsd.NewEvent("d", "text"))
+	r.ServiceCheck(&ServiceCheck{Name: "e", Tags: []string{"team:payments"}})
+	assert.NoError(t, r.Close())
+
+	assert.Equal(t, []string{"_e{1,4}:d|text", "c:1.000000|g|#environment:production"}, fallback.packets())
+	assert.Equal(t, []string{"_sc|e|0|#team:payments", "a:1|c|#team:payments", "b:1|c|#canary,environment:production,team:payments"}, payments.packets())
+	assert.Equal(t, []string{"b:1|c|#canary,environment:production,team:payments"}, prod.packets())
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	s, _ := newTestStatsd(t)
+	defer s.Close()
+
+	_, err := NewRouter(s, []RouteConfig{{}})
+	assert.EqualError(t, err, "sink has no destination")
+}
@@ -0,0 +1,207 @@
+package dockerdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// defaultServiceCheckInterval is how often the connection to the
+	// Docker daemon is checked, when not configured.
+	defaultServiceCheckInterval = 15 * time.Second
+
+	// healthServiceCheck is the name of the service check reported for
+	// container health_status events.
+	healthServiceCheck = "docker.container.health"
+
+	// daemonServiceCheck is the name of the service check reported for
+	// dockerdog's connection to the Docker daemon.
+	daemonServiceCheck = "dockerdog.can_connect"
+)
+
+// ServiceChecksConfig configures DogStatsD service checks.
+type ServiceChecksConfig struct {
+	// Interval is how often the connection to the Docker daemon is
+	// checked.
+	Interval Duration `json:"interval"`
+}
+
+// ServiceCheckStatus is the status of a service check.
+type ServiceCheckStatus int
+
+const (
+	ServiceCheckOK       ServiceCheckStatus = 0
+	ServiceCheckWarning  ServiceCheckStatus = 1
+	ServiceCheckCritical ServiceCheckStatus = 2
+	ServiceCheckUnknown  ServiceCheckStatus = 3
+)
+
+// healthStatuses maps the status of a container health_status event to a
+// service check status.
+var healthStatuses = map[string]ServiceCheckStatus{
+	"healthy":   ServiceCheckOK,
+	"unhealthy": ServiceCheckCritical,
+}
+
+// ServiceCheck is a DogStatsD service check.
+type ServiceCheck struct {
+	// Name of the service check. Required.
+	Name string
+	// Status of the service check. Required.
+	Status ServiceCheckStatus
+	// Timestamp is when the check ran. If not provided, the dogstatsd
+	// server will set this to the current time.
+	Timestamp time.Time
+	// Hostname for the service check.
+	Hostname string
+	// Message describes the current status of the check.
+	Message string
+	// Tags for the service check.
+	Tags []string
+}
+
+// Encode returns the dogstatsd wire protocol representation for the service
+// check.
+func (sc *ServiceCheck) Encode() (string, error) {
+	if sc.Name == "" {
+		return "", fmt.Errorf("service check name is required")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("_sc|")
+	buf.WriteString(sc.Name)
+	buf.WriteRune('|')
+	buf.WriteString(strconv.Itoa(int(sc.Status)))
+
+	if !sc.Timestamp.IsZero() {
+		buf.WriteString("|d:")
+		buf.WriteString(strconv.FormatInt(sc.Timestamp.Unix(), 10))
+	}
+
+	if sc.Hostname != "" {
+		buf.WriteString("|h:")
+		buf.WriteString(sc.Hostname)
+	}
+
+	if len(sc.Tags) > 0 {
+		buf.WriteString("|#")
+		buf.WriteString(strings.Join(sc.Tags, ","))
+	}
+
+	// The message must come last, and can't contain newlines.
+	if sc.Message != "" {
+		buf.WriteString("|m:")
+		buf.WriteString(strings.Replace(sc.Message, "\n", "\\n", -1))
+	}
+
+	return buf.String(), nil
+}
+
+// serviceCheckClient sends service checks to DogStatsD. The vendored statsd
+// client doesn't support service checks, so this writes to its own
+// connection.
+type serviceCheckClient struct {
+	conn net.Conn
+}
+
+func newServiceCheckClient(addr string) (*serviceCheckClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &serviceCheckClient{conn: conn}, nil
+}
+
+// ServiceCheck sends the service check.
+func (c *serviceCheckClient) ServiceCheck(sc *ServiceCheck) error {
+	if c == nil {
+		return nil
+	}
+	msg, err := sc.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write([]byte(msg))
+	return err
+}
+
+// Close closes the connection.
+func (c *serviceCheckClient) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// healthCheck returns the service check for a container health_status
+// event, or nil if the event isn't one.
+func healthCheck(event *docker.APIEvents, tags []string) *ServiceCheck {
+	action, health := splitAction(event.Action)
+	if event.Type != "container" || action != "health_status" {
+		return nil
+	}
+
+	status, ok := healthStatuses[health]
+	if !ok {
+		status = ServiceCheckUnknown
+	}
+
+	name := event.Actor.Attributes["name"]
+	if name == "" {
+		name = event.Actor.ID
+	}
+
+	return &ServiceCheck{
+		Name:      healthServiceCheck,
+		Status:    status,
+		Timestamp: eventTime(event),
+		Message:   fmt.Sprintf("container %s is %s", name, health),
+		Tags:      append([]string{fmt.Sprintf("container_name:%s", name)}, tags...),
+	}
+}
+
+// checkDaemon reports whether the Docker daemon can be reached every
+// interval, until ctx is cancelled. A ping that takes longer than the interval
+// is critical. A ping in flight when ctx is cancelled is still reported, so
+// that shutting down isn't mistaken for the daemon being unreachable.
+func checkDaemon(ctx context.Context, api *daemonAPI, s Sink, config ServiceChecksConfig) {
+	interval := config.Interval.Duration
+	if interval <= 0 {
+		interval = defaultServiceCheckInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		sc := &ServiceCheck{
+			Name:   daemonServiceCheck,
+			Status: ServiceCheckOK,
+		}
+		if err := pingWithin(api, interval); err != nil {
+			sc.Status = ServiceCheckCritical
+			sc.Message = err.Error()
+		}
+		s.ServiceCheck(sc)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pingWithin pings the daemon, and times out after timeout.
+func pingWithin(api *daemonAPI, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return api.ping(ctx)
+}
@@ -0,0 +1,87 @@
+package dockerdog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceCheck_Encode(t *testing.T) {
+	tests := []struct {
+		sc  ServiceCheck
+		out string
+	}{
+		{ServiceCheck{Name: "a.b", Status: ServiceCheckOK}, "_sc|a.b|0"},
+		{ServiceCheck{Name: "a.b", Status: ServiceCheckCritical, Timestamp: time.Unix(1470000000, 0), Hostname: "host", Tags: []string{"a:b", "c"}, Message: "down\nhard"}, "_sc|a.b|2|d:1470000000|h:host|#a:b,c|m:down\\nhard"},
+	}
+
+	for _, tt := range tests {
+		out, err := tt.sc.Encode()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.out, out)
+	}
+
+	_, err := (&ServiceCheck{}).Encode()
+	assert.Error(t, err)
+}
+
+func TestHealthCheck(t *testing.T) {
+	event := &docker.APIEvents{
+		Type:   "container",
+		Action: "health_status: unhealthy",
+		Time:   1470000000,
+		Actor: docker.APIActor{
+			ID:         "abcd",
+			Attributes: map[string]string{"name": "web"},
+		},
+	}
+
+	assert.Equal(t, &ServiceCheck{
+		Name:      "docker.container.health",
+		Status:    ServiceCheckCritical,
+		Timestamp: time.Unix(1470000000, 0),
+		Message:   "container web is unhealthy",
+		Tags:      []string{"container_name:web", "image:app"},
+	}, healthCheck(event, []string{"image:app"}))
+
+	event.Action = "health_status: healthy"
+	assert.Equal(t, ServiceCheckOK, healthCheck(event, nil).Status)
+
+	event.Action = "start"
+	assert.Nil(t, healthCheck(event, nil))
+}
+
+func TestCheckDaemon_Hung(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer daemon.Close()
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		checkDaemon(ctx, newTestEventStream(t, daemon.URL, nil).api, s, ServiceChecksConfig{Interval: Duration{50 * time.Millisecond}})
+		close(done)
+	}()
+
+	// A ping that times out is critical.
+	got := packets(1)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("daemon check didn't stop")
+	}
+	if assert.Len(t, got, 1) {
+		assert.True(t, strings.HasPrefix(got[0], "_sc|dockerdog.can_connect|2|"), got[0])
+	}
+}
@@ -0,0 +1,106 @@
+package dockerdog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+)
+
+// Sink receives the metrics, events and service checks reported by a
+// Watcher. The rate is the sample rate, which is always 1.
+type Sink interface {
+	Count(name string, value int64, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	Histogram(name string, value float64, tags []string, rate float64) error
+	Set(name string, value string, tags []string, rate float64) error
+	TimeInMilliseconds(name string, value float64, tags []string, rate float64) error
+	Event(e *statsd.Event) error
+	ServiceCheck(sc *ServiceCheck) error
+
+	// Close flushes anything that's buffered, and releases resources.
+	Close() error
+}
+
+// TimestampSink is a Sink that can report at a time other than now, so that
+// metrics for past events, e.g. when streaming with -since or replaying a
+// file, are reported when the events happened.
+type TimestampSink interface {
+	Sink
+
+	// At returns a Sink that reports at t. It must not be closed.
+	At(t time.Time) Sink
+}
+
+// sinkAt returns a Sink that reports to s at t, if s supports timestamps, or
+// s.
+func sinkAt(s Sink, t time.Time) Sink {
+	if ts, ok := s.(TimestampSink); ok {
+		return ts.At(t)
+	}
+	return s
+}
+
+// StatsdSink sends to DogStatsD.
+type StatsdSink struct {
+	*statsd.Client
+	checks *serviceCheckClient
+}
+
+// NewStatsdSink returns a Sink that sends to the DogStatsD server at addr.
+func NewStatsdSink(addr string) (*StatsdSink, error) {
+	s, err := statsd.New(addr)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := newServiceCheckClient(addr)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &StatsdSink{Client: s, checks: checks}, nil
+}
+
+// ServiceCheck sends the service check.
+func (s *StatsdSink) ServiceCheck(sc *ServiceCheck) error {
+	return s.checks.ServiceCheck(sc)
+}
+
+// Close flushes metrics, and closes the connections to DogStatsD.
+func (s *StatsdSink) Close() error {
+	err := s.Client.Close()
+	if cerr := s.checks.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SinkConfig configures a sink. Exactly one destination must be set.
+type SinkConfig struct {
+	// Statsd is the address of a DogStatsD server.
+	Statsd string `json:"statsd"`
+
+	// Datadog sends to the Datadog HTTP API.
+	Datadog *DatadogConfig `json:"datadog"`
+
+	// InfluxDB writes to InfluxDB, in the line protocol.
+	InfluxDB *InfluxConfig `json:"influxdb"`
+
+	// OTLP exports to an OpenTelemetry collector.
+	OTLP *OTLPConfig `json:"otlp"`
+}
+
+// NewSink returns the sink configured by c.
+func NewSink(c SinkConfig) (Sink, error) {
+	switch {
+	case c.Statsd != "":
+		return NewStatsdSink(c.Statsd)
+	case c.Datadog != nil:
+		return NewDatadogSink(*c.Datadog)
+	case c.InfluxDB != nil:
+		return NewInfluxSink(*c.InfluxDB)
+	case c.OTLP != nil:
+		return NewOTLPSink(*c.OTLP)
+	}
+	return nil, fmt.Errorf("sink has no destination")
+}
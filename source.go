@@ -0,0 +1,102 @@
+package dockerdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// ReaderSource is an EventSource that reads events from JSON, like the output
+// of `docker events --format '{{json .}}'` or a file recorded from it.
+type ReaderSource struct {
+	Reader io.Reader
+
+	// Speed controls how events are replayed. When 0, events are sent as
+	// fast as they're read. Otherwise, the original time between events
+	// is kept, divided by Speed, e.g. 10 replays events 10 times faster
+	// than they happened.
+	Speed float64
+
+	// Events before Since are skipped, and the source ends at the first
+	// event after Until. Either may be zero.
+	Since, Until time.Time
+}
+
+// Events sends the events read from Reader to ch. Events are decoded in the
+// background, so that cancelling ctx returns straight away, even while
+// waiting for Reader, which is left to the caller to close.
+func (s *ReaderSource) Events(ctx context.Context, ch chan<- *docker.APIEvents) error {
+	decoded := make(chan decodedEvent)
+	done := make(chan bool)
+	defer close(done)
+	go decodeEvents(json.NewDecoder(s.Reader), decoded, done)
+
+	var prev time.Time
+	for {
+		var d decodedEvent
+		select {
+		case d = <-decoded:
+		case <-ctx.Done():
+			return nil
+		}
+		if d.err != nil {
+			if d.err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error decoding event: %v", d.err)
+		}
+		event := d.event
+
+		normalizeEvent(event)
+
+		t := eventTime(event)
+		if !s.Since.IsZero() && t.Before(s.Since) {
+			continue
+		}
+		if !s.Until.IsZero() && t.After(s.Until) {
+			return nil
+		}
+		if s.Speed > 0 && !prev.IsZero() && t.After(prev) {
+			select {
+			case <-time.After(time.Duration(float64(t.Sub(prev)) / s.Speed)):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		prev = t
+
+		select {
+		case ch <- event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// decodedEvent is an event, or the error that ended decoding.
+type decodedEvent struct {
+	event *docker.APIEvents
+	err   error
+}
+
+// decodeEvents sends the events decoded by decoder to ch, until it fails, or
+// done is closed.
+func decodeEvents(decoder *json.Decoder, ch chan<- decodedEvent, done <-chan bool) {
+	for {
+		var d decodedEvent
+		d.event = new(docker.APIEvents)
+		d.err = decoder.Decode(d.event)
+		select {
+		case ch <- d:
+		case <-done:
+			return
+		}
+		if d.err != nil {
+			return
+		}
+	}
+}
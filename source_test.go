@@ -0,0 +1,121 @@
+package dockerdog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderSource_Events(t *testing.T) {
+	r := strings.NewReader(`{"status":"start","id":"abcd","from":"nginx","Type":"container","Action":"start","Actor":{"ID":"abcd","Attributes":{"image":"nginx","name":"web"}},"time":1470000000,"timeNano":1470000000000000000}
+{"status":"stop","id":"abcd","from":"nginx","time":1470000001}
+`)
+
+	events := make(chan *docker.APIEvents, 2)
+	err := (&ReaderSource{Reader: r}).Events(context.Background(), events)
+	assert.NoError(t, err)
+	close(events)
+
+	var got []*docker.APIEvents
+	for event := range events {
+		got = append(got, event)
+	}
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, "start", got[0].Action)
+		assert.Equal(t, "web", got[0].Actor.Attributes["name"])
+		// Events from older daemons are normalized.
+		assert.Equal(t, "container", got[1].Type)
+		assert.Equal(t, "stop", got[1].Action)
+		assert.Equal(t, "nginx", got[1].Actor.Attributes["image"])
+	}
+}
+
+func TestReaderSource_Events_SinceUntil(t *testing.T) {
+	r := strings.NewReader(`{"Type":"container","Action":"create","time":1470000000}
+{"Type":"container","Action":"start","time":1470000001}
+{"Type":"container","Action":"die","time":1470000002}
+`)
+
+	events := make(chan *docker.APIEvents, 3)
+	err := (&ReaderSource{
+		Reader: r,
+		Since:  time.Unix(1470000001, 0),
+		Until:  time.Unix(1470000001, 0),
+	}).Events(context.Background(), events)
+	assert.NoError(t, err)
+	close(events)
+
+	var actions []string
+	for event := range events {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{"start"}, actions)
+}
+
+func TestReaderSource_Events_Speed(t *testing.T) {
+	r := strings.NewReader(`{"Type":"container","Action":"start","timeNano":1470000000000000000}
+{"Type":"container","Action":"die","timeNano":1470000001000000000}
+`)
+
+	events := make(chan *docker.APIEvents, 2)
+	start := time.Now()
+	err := (&ReaderSource{Reader: r, Speed: 10}).Events(context.Background(), events)
+	assert.NoError(t, err)
+
+	// The second between events is replayed 10 times faster.
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 100*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < time.Second, "elapsed %v", elapsed)
+}
+
+func TestReaderSource_Events_DecodeError(t *testing.T) {
+	events := make(chan *docker.APIEvents, 1)
+	err := (&ReaderSource{Reader: strings.NewReader(`{"Type":`)}).Events(context.Background(), events)
+	assert.Error(t, err)
+}
+
+func TestReaderSource_Events_Cancel(t *testing.T) {
+	r := strings.NewReader(`{"Type":"container","Action":"start","time":1470000000}
+{"Type":"container","Action":"die","time":1470003600}
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *docker.APIEvents, 2)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- (&ReaderSource{Reader: r, Speed: 1}).Events(ctx, events)
+	}()
+
+	<-events
+	cancel()
+	assert.NoError(t, <-errc)
+}
+
+func TestReaderSource_Events_CancelIdle(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *docker.APIEvents, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- (&ReaderSource{Reader: r}).Events(ctx, events)
+	}()
+
+	// Cancelling returns while waiting for the next event.
+	fmt.Fprintln(w, `{"Type":"container","Action":"start","time":1470000000}`)
+	<-events
+	cancel()
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("source didn't return")
+	}
+}
@@ -0,0 +1,262 @@
+package dockerdog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// StatsConfig configures the collection of resource stats for running
+// containers.
+type StatsConfig struct {
+	// Attributes configures the container attributes, in addition to the
+	// global attributes, that stats should be tagged with.
+	Attributes map[string]bool `json:"attributes"`
+}
+
+// statsCollector streams resource stats for running containers from the
+// Docker daemon, and reports them to a Sink. Collection for a container is
+// started and stopped as its start and die events arrive.
+type statsCollector struct {
+	client *docker.Client
+	config *Config
+	sink   Sink
+
+	// labels is nil when containers can't control how they're reported
+	// with labels.
+	labels *containerLabels
+
+	mu sync.Mutex
+	// containers maps the ID of each container that stats are being
+	// collected for, to the channel that stops collection.
+	containers map[string]chan bool
+	wg         sync.WaitGroup
+}
+
+func newStatsCollector(c *docker.Client, config *Config, s Sink) *statsCollector {
+	collector := &statsCollector{
+		client:     c,
+		config:     config,
+		sink:       s,
+		containers: make(map[string]chan bool),
+	}
+	if config.Labels != nil {
+		collector.labels = newContainerLabels(*config.Labels)
+	}
+	return collector
+}
+
+// handle starts or stops collecting stats when a container starts or dies.
+func (c *statsCollector) handle(event *docker.APIEvents) {
+	if event.Type != "container" {
+		return
+	}
+	switch event.Action {
+	case "start":
+		c.start(event.Actor.ID, event.Actor.Attributes)
+	case "die", "destroy":
+		c.stop(event.Actor.ID)
+	}
+}
+
+// startRunning starts collecting stats for all running containers.
+func (c *statsCollector) startRunning() error {
+	containers, err := c.client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list containers: %v", err)
+	}
+	for _, container := range containers {
+		attributes := containerAttributes(container)
+		if c.labels != nil && c.labels.ignored(attributes) {
+			continue
+		}
+		// Filter containers as if they just started.
+		event := &docker.APIEvents{Type: "container", Action: "start", Actor: docker.APIActor{ID: container.ID, Attributes: attributes}}
+		if !(&containerFilter{config: c.config}).Process(event) || !(&actionFilter{config: c.config}).Process(event) {
+			continue
+		}
+		c.start(container.ID, attributes)
+	}
+	return nil
+}
+
+// start starts collecting stats for the container, if they're not already
+// being collected.
+func (c *statsCollector) start(id string, attributes map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.containers[id]; ok {
+		return
+	}
+
+	done := make(chan bool)
+	c.containers[id] = done
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.collect(id, c.tags(attributes), done)
+
+		c.mu.Lock()
+		if c.containers[id] == done {
+			delete(c.containers, id)
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// stop stops collecting stats for the container.
+func (c *statsCollector) stop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if done, ok := c.containers[id]; ok {
+		close(done)
+		delete(c.containers, id)
+	}
+}
+
+// stopAll stops collecting stats for all containers, and waits for
+// collection to finish.
+func (c *statsCollector) stopAll() {
+	c.mu.Lock()
+	for id, done := range c.containers {
+		close(done)
+		delete(c.containers, id)
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+// collect reports the stats for the container until done is closed, or the
+// container is removed.
+func (c *statsCollector) collect(id string, tags []string, done chan bool) {
+	stats := make(chan *docker.Stats)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.client.Stats(docker.StatsOptions{
+			ID:     id,
+			Stats:  stats,
+			Stream: true,
+			Done:   done,
+		})
+	}()
+
+	var prev *docker.Stats
+	for s := range stats {
+		reportStats(c.sink, s, prev, tags)
+		prev = s
+	}
+
+	if err := <-errc; err != nil {
+		select {
+		case <-done:
+			// Stopping collection interrupts the stream.
+		default:
+			log.Printf("error collecting stats for container %s: %v", id, err)
+		}
+	}
+}
+
+// tags returns the tags for the enabled attributes of a container.
+func (c *statsCollector) tags(attributes map[string]string) []string {
+	enabled := c.config.statsAttributes()
+
+	var tags []string
+	for k, v := range attributes {
+		if enabled[k] {
+			tags = append(tags, fmt.Sprintf("%s:%s", c.config.tag(k), v))
+		}
+	}
+	if c.labels != nil {
+		tags = append(tags, c.labels.tagsFor(attributes)...)
+	}
+	return tags
+}
+
+// containerAttributes returns the attributes that the Docker daemon includes
+// in container events, for a container returned by ListContainers.
+func containerAttributes(container docker.APIContainers) map[string]string {
+	attributes := make(map[string]string)
+	for k, v := range container.Labels {
+		attributes[k] = v
+	}
+	attributes["image"] = container.Image
+	if len(container.Names) > 0 {
+		attributes["name"] = strings.TrimPrefix(container.Names[0], "/")
+	}
+	return attributes
+}
+
+// reportStats reports a stats sample for a container. Cumulative values, like
+// bytes received, are reported as counts of the difference from the previous
+// sample, prev, which is nil for the first sample.
+func reportStats(s Sink, stats, prev *docker.Stats, tags []string) {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+		if cpus == 0 {
+			cpus = 1
+		}
+		s.Gauge("docker.container.cpu.percent", cpuDelta/systemDelta*cpus*100, tags, 1)
+	}
+
+	s.Gauge("docker.container.mem.usage", float64(stats.MemoryStats.Usage), tags, 1)
+	s.Gauge("docker.container.mem.limit", float64(stats.MemoryStats.Limit), tags, 1)
+	s.Gauge("docker.container.mem.cache", float64(stats.MemoryStats.Stats.Cache), tags, 1)
+	s.Gauge("docker.container.mem.rss", float64(stats.MemoryStats.Stats.Rss), tags, 1)
+
+	if prev == nil {
+		return
+	}
+
+	rx, tx := networkBytes(stats)
+	prevRx, prevTx := networkBytes(prev)
+	countDelta(s, "docker.container.net.rx_bytes", rx, prevRx, tags)
+	countDelta(s, "docker.container.net.tx_bytes", tx, prevTx, tags)
+
+	read, write := blkioBytes(stats)
+	prevRead, prevWrite := blkioBytes(prev)
+	countDelta(s, "docker.container.io.read_bytes", read, prevRead, tags)
+	countDelta(s, "docker.container.io.write_bytes", write, prevWrite, tags)
+}
+
+// countDelta reports the increase in a cumulative value. Counters that went
+// backwards, e.g. because an interface was removed, are ignored.
+func countDelta(s Sink, name string, value, prev uint64, tags []string) {
+	if value > prev {
+		s.Count(name, int64(value-prev), tags, 1)
+	}
+}
+
+// networkBytes returns the total bytes received and sent across all of the
+// container's network interfaces.
+func networkBytes(stats *docker.Stats) (rx, tx uint64) {
+	if len(stats.Networks) == 0 {
+		return stats.Network.RxBytes, stats.Network.TxBytes
+	}
+	for _, n := range stats.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// blkioBytes returns the total bytes read and written across all of the
+// container's block devices.
+func blkioBytes(stats *docker.Stats) (read, write uint64) {
+	for _, e := range stats.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	return read, write
+}
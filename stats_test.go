@@ -0,0 +1,146 @@
+package dockerdog
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsCollector(t *testing.T) {
+	d := newFakeDocker(t, "1.24")
+	defer d.Close()
+	d.containers = []docker.APIContainers{
+		{ID: "web", Names: []string{"/web"}, Image: "nginx", State: "running"},
+		{ID: "ignored", Names: []string{"/ignored"}, Image: "nginx", State: "running", Labels: map[string]string{"dockerdog.ignore": "true"}},
+		{ID: "pause", Names: []string{"/pause"}, Image: "k8s.gcr.io/pause:3.1", State: "running"},
+	}
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "labels": {},
+  "exclude": {"image": ["k8s.gcr.io/pause*"]},
+  "stats": {}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := docker.NewVersionedClient(d.URL, "1.24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestStatsd(t)
+	defer s.Close()
+
+	// open waits for the stats streams that are open to be ids.
+	open := func(ids ...string) {
+		for i := 0; i < 100; i++ {
+			if assert.ObjectsAreEqual(ids, d.openStats()) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, ids, d.openStats())
+	}
+	event := func(action, id string) *docker.APIEvents {
+		return &docker.APIEvents{Type: "container", Action: action, Actor: docker.APIActor{ID: id, Attributes: map[string]string{"name": id}}}
+	}
+
+	c := newStatsCollector(client, config, s)
+
+	// Ignored and excluded containers that are already running aren't
+	// collected.
+	assert.NoError(t, c.startRunning())
+	open("web")
+
+	c.handle(event("start", "db"))
+	c.handle(event("start", "api"))
+	open("api", "db", "web")
+
+	c.handle(event("die", "db"))
+	c.handle(event("destroy", "api"))
+	open("web")
+
+	c.handle(event("start", "db"))
+	open("db", "web")
+
+	c.stopAll()
+	open()
+}
+
+func TestReportStats(t *testing.T) {
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	prev := new(docker.Stats)
+	prev.Networks = map[string]docker.NetworkStats{"eth0": {RxBytes: 100, TxBytes: 50}}
+	prev.BlkioStats.IOServiceBytesRecursive = []docker.BlkioStatsEntry{{Op: "Read", Value: 10}}
+
+	stats := new(docker.Stats)
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150}
+	stats.CPUStats.SystemCPUUsage = 2000
+	stats.PreCPUStats.CPUUsage.TotalUsage = 100
+	stats.PreCPUStats.SystemCPUUsage = 1000
+	stats.MemoryStats.Usage = 1024
+	stats.MemoryStats.Limit = 2048
+	stats.Networks = map[string]docker.NetworkStats{"eth0": {RxBytes: 150, TxBytes: 50}}
+	stats.BlkioStats.IOServiceBytesRecursive = []docker.BlkioStatsEntry{{Op: "Read", Value: 30}, {Op: "Write", Value: 5}}
+
+	reportStats(s, stats, prev, []string{"image:nginx"})
+
+	assert.Equal(t, []string{
+		"docker.container.cpu.percent:40.000000|g|#image:nginx",
+		"docker.container.io.read_bytes:20|c|#image:nginx",
+		"docker.container.io.write_bytes:5|c|#image:nginx",
+		"docker.container.mem.cache:0.000000|g|#image:nginx",
+		"docker.container.mem.limit:2048.000000|g|#image:nginx",
+		"docker.container.mem.rss:0.000000|g|#image:nginx",
+		"docker.container.mem.usage:1024.000000|g|#image:nginx",
+		"docker.container.net.rx_bytes:50|c|#image:nginx",
+	}, packets(8))
+}
+
+func TestContainerAttributes(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"image": "nginx",
+		"name":  "web",
+		"team":  "payments",
+	}, containerAttributes(docker.APIContainers{
+		Image:  "nginx",
+		Names:  []string{"/web"},
+		Labels: map[string]string{"team": "payments"},
+	}))
+}
+
+// newTestStatsd returns a statsd sink that sends to a local UDP listener, and
+// a function that returns the next n packets received, sorted.
+func newTestStatsd(t testing.TB) (*StatsdSink, func(n int) []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStatsdSink(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, func(n int) []string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for i := 0; i < n; i++ {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			m, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packets = append(packets, string(buf[:m]))
+		}
+		sort.Strings(packets)
+		return packets
+	}
+}
@@ -0,0 +1,384 @@
+package dockerdog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	defaultSyslogAddress  = "unix:///dev/log"
+	defaultSyslogFacility = "daemon"
+	defaultSyslogSeverity = "info"
+	defaultSyslogAppName  = "dockerdog"
+
+	// defaultSyslogSDID is the ID of the structured data element, under
+	// the IANA's example enterprise number.
+	defaultSyslogSDID = "dockerdog@32473"
+
+	syslogTimeout = 5 * time.Second
+
+	// maxBufferedRecords is the most records that an audit log buffers
+	// while they're being written. Later records are dropped.
+	maxBufferedRecords = 10000
+)
+
+// Formats of syslog messages.
+const (
+	syslogText       = "text"
+	syslogStructured = "structured"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// SyslogConfig configures writing a record of each selected event to syslog,
+// in the RFC 5424 format.
+type SyslogConfig struct {
+	// Address is where records are sent: unix:///dev/log (the default),
+	// udp://host:514 or tcp://host:601.
+	Address string `json:"address"`
+
+	// Format is text (the default), a human-readable message, or
+	// structured, which adds the event's type, action, actor ID and tags
+	// as structured data.
+	Format string `json:"format"`
+
+	// Events selects the events that are written, by type and action,
+	// e.g. {"container": ["start", "die", "exec_start"]}. All events are
+	// written by default.
+	Events map[string][]string `json:"events"`
+
+	// Facility and Severity are the names of the facility (daemon by
+	// default) and severity (info by default) of records.
+	Facility string `json:"facility"`
+	Severity string `json:"severity"`
+
+	// AppName is the APP-NAME of records, dockerdog by default.
+	AppName string `json:"app_name"`
+}
+
+// validate returns an error if syslog is misconfigured.
+func (c *SyslogConfig) validate() error {
+	switch c.Format {
+	case "", syslogText, syslogStructured:
+	default:
+		return fmt.Errorf("unknown syslog format %q", c.Format)
+	}
+	if _, ok := syslogFacilities[c.Facility]; c.Facility != "" && !ok {
+		return fmt.Errorf("unknown syslog facility %q", c.Facility)
+	}
+	if _, ok := syslogSeverities[c.Severity]; c.Severity != "" && !ok {
+		return fmt.Errorf("unknown syslog severity %q", c.Severity)
+	}
+	if c.Address != "" {
+		if _, _, err := syslogNetwork(c.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syslogNetwork returns the network and address to dial for a syslog address.
+func syslogNetwork(address string) (string, string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address: %v", err)
+	}
+	switch u.Scheme {
+	case "unix":
+		return "unixgram", u.Path, nil
+	case "udp", "tcp":
+		return u.Scheme, u.Host, nil
+	}
+	return "", "", fmt.Errorf("syslog address must be unix, udp or tcp, not %q", u.Scheme)
+}
+
+// syslogWriter is an eventSink that writes a record of each selected event to
+// syslog, with a recordWriter.
+type syslogWriter struct {
+	*recordWriter
+	network, addr string
+	format        string
+	events        map[string][]string
+	priority      int
+	appName       string
+	host          string
+}
+
+// newSyslogWriter returns a syslogWriter, and starts writing records. Syslog
+// doesn't need to be reachable until the first record is written.
+func newSyslogWriter(c SyslogConfig) (*syslogWriter, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	address := c.Address
+	if address == "" {
+		address = defaultSyslogAddress
+	}
+	network, addr, err := syslogNetwork(address)
+	if err != nil {
+		return nil, err
+	}
+	facility, severity := c.Facility, c.Severity
+	if facility == "" {
+		facility = defaultSyslogFacility
+	}
+	if severity == "" {
+		severity = defaultSyslogSeverity
+	}
+
+	w := &syslogWriter{
+		network:  network,
+		addr:     addr,
+		format:   c.Format,
+		events:   c.Events,
+		priority: syslogFacilities[facility]*8 + syslogSeverities[severity],
+		appName:  c.AppName,
+	}
+	if w.format == "" {
+		w.format = syslogText
+	}
+	if w.appName == "" {
+		w.appName = defaultSyslogAppName
+	}
+	w.host, _ = os.Hostname()
+
+	var frame func([]byte) []byte
+	if network == "tcp" {
+		// Records sent over TCP are framed by octet counting.
+		frame = func(record []byte) []byte {
+			return append([]byte(fmt.Sprintf("%d ", len(record))), record...)
+		}
+	}
+	w.recordWriter = newRecordWriter("syslog "+addr, network, addr, frame)
+	return w, nil
+}
+
+// send buffers a record of the event, if it's selected.
+func (w *syslogWriter) send(event *docker.APIEvents, tags []string) {
+	if !selected(w.events, event) {
+		return
+	}
+	w.write(w.record(event, tags))
+}
+
+// record returns the RFC 5424 record for the event:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [STRUCTURED-DATA] MSG
+func (w *syslogWriter) record(event *docker.APIEvents, tags []string) []byte {
+	action, _ := splitAction(event.Action)
+	t := time.Now()
+	if event.TimeNano != 0 || event.Time != 0 {
+		t = eventTime(event)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		w.priority,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogField(w.host, 255),
+		syslogField(w.appName, 48),
+		os.Getpid(),
+		syslogField(action, 32),
+	)
+
+	if w.format == syslogStructured {
+		b.WriteString("[" + defaultSyslogSDID)
+		params := [][2]string{{"type", event.Type}, {"action", action}, {"id", event.Actor.ID}}
+		for _, tag := range tags {
+			params = append(params, [2]string{"tag", tag})
+		}
+		for _, p := range params {
+			fmt.Fprintf(&b, ` %s="%s"`, p[0], syslogParamEscaper.Replace(p[1]))
+		}
+		b.WriteString("] ")
+	} else {
+		b.WriteString("- ")
+	}
+
+	b.WriteString(eventMessage(event, tags))
+	return b.Bytes()
+}
+
+// recordWriter writes records to an audit log from its own goroutine, so that
+// a slow or unreachable log doesn't hold up events. Records are written as soon
+// as they're buffered; if one can't be written, the connection is
+// re-established, and it's retried once. If that fails too, it and the other
+// buffered records are dropped, and an error is logged. Records are also
+// dropped while maxBufferedRecords are buffered.
+type recordWriter struct {
+	name  string
+	dial  func() (net.Conn, error)
+	limit int
+
+	// frame frames records for a stream. It's nil for datagrams.
+	frame func(record []byte) []byte
+
+	mu sync.Mutex
+	// buffered are the records that haven't been written.
+	buffered [][]byte
+	// dropped is the number of records dropped since the buffer was
+	// last full.
+	dropped int
+
+	// conn is only used by the writing goroutine.
+	conn net.Conn
+
+	// ready is signalled when records are buffered.
+	ready chan bool
+	done  chan bool
+	wg    sync.WaitGroup
+}
+
+// newRecordWriter returns a recordWriter that writes to addr on network, and
+// starts writing records. name identifies the log in errors.
+func newRecordWriter(name, network, addr string, frame func([]byte) []byte) *recordWriter {
+	w := &recordWriter{
+		name: name,
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(network, addr, syslogTimeout)
+		},
+		limit: maxBufferedRecords,
+		frame: frame,
+		ready: make(chan bool, 1),
+		done:  make(chan bool),
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case <-w.ready:
+				w.flush()
+			case <-w.done:
+				w.flush()
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// write buffers the record to be written.
+func (w *recordWriter) write(record []byte) {
+	w.mu.Lock()
+	if len(w.buffered) >= w.limit {
+		if w.dropped == 0 {
+			log.Printf("%s is falling behind, dropping records", w.name)
+		}
+		w.dropped++
+		w.mu.Unlock()
+		return
+	}
+	w.buffered = append(w.buffered, record)
+	w.mu.Unlock()
+
+	select {
+	case w.ready <- true:
+	default:
+	}
+}
+
+// flush writes the buffered records.
+func (w *recordWriter) flush() {
+	w.mu.Lock()
+	buffered := w.buffered
+	w.buffered = nil
+	if w.dropped > 0 {
+		log.Printf("dropped %d records for %s", w.dropped, w.name)
+		w.dropped = 0
+	}
+	w.mu.Unlock()
+
+	for i, record := range buffered {
+		if w.frame != nil {
+			record = w.frame(record)
+		}
+		if err := w.writeRecord(record); err != nil {
+			if w.conn != nil {
+				w.conn.Close()
+				w.conn = nil
+			}
+			if err := w.writeRecord(record); err != nil {
+				log.Printf("error writing to %s, dropping %d records: %v", w.name, len(buffered)-i, err)
+				return
+			}
+		}
+	}
+}
+
+// writeRecord writes a record, connecting to the log if necessary.
+func (w *recordWriter) writeRecord(record []byte) error {
+	if w.conn == nil {
+		conn, err := w.dial()
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := w.conn.Write(record)
+	return err
+}
+
+// Close writes the buffered records, and closes the connection to the log.
+func (w *recordWriter) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// eventMessage returns a human-readable message for the event, with its type,
+// action, actor ID and tags, e.g. "container die abc123 name:web". Payloads,
+// like exec commands, are only included as tags, if configured, since they
+// can contain secrets.
+func eventMessage(event *docker.APIEvents, tags []string) string {
+	action, _ := splitAction(event.Action)
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	return strings.Join(append([]string{event.Type, action, event.Actor.ID}, sorted...), " ")
+}
+
+// syslogField returns a header field, which must be printable ASCII without
+// spaces, or "-" if it's empty.
+func syslogField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
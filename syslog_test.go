@@ -0,0 +1,242 @@
+package dockerdog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// readDatagrams returns the datagrams received until none arrive for 100ms.
+func readDatagrams(conn net.PacketConn) []string {
+	var datagrams []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return datagrams
+		}
+		datagrams = append(datagrams, string(buf[:n]))
+	}
+}
+
+func testAuditEvents() []*docker.APIEvents {
+	return []*docker.APIEvents{
+		{Type: "container", Action: "exec_start: /bin/sh -c 'echo secret'", Actor: docker.APIActor{ID: "abc"}, TimeNano: 1500000000123456000},
+		{Type: "container", Action: "die", Actor: docker.APIActor{ID: "abc"}, TimeNano: 1500000001000000000},
+		{Type: "image", Action: "pull", Actor: docker.APIActor{ID: "redis"}},
+	}
+}
+
+func TestSyslogWriter_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newSyslogWriter(SyslogConfig{
+		Address:  "udp://" + conn.LocalAddr().String(),
+		Format:   "structured",
+		Events:   map[string][]string{"container": {"exec_start", "die"}},
+		Facility: "auth",
+		Severity: "notice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.host = "web-1"
+	for _, event := range testAuditEvents() {
+		w.send(event, []string{"name:web", `cmd:"quoted"`})
+	}
+	assert.NoError(t, w.Close())
+
+	pid := os.Getpid()
+	assert.Equal(t, []string{
+		fmt.Sprintf(`<37>1 2017-07-14T02:40:00.123456Z web-1 dockerdog %d exec_start [dockerdog@32473 type="container" action="exec_start" id="abc" tag="name:web" tag="cmd:\"quoted\""] container exec_start abc cmd:"quoted" name:web`, pid),
+		fmt.Sprintf(`<37>1 2017-07-14T02:40:01.000000Z web-1 dockerdog %d die [dockerdog@32473 type="container" action="die" id="abc" tag="name:web" tag="cmd:\"quoted\""] container die abc cmd:"quoted" name:web`, pid),
+	}, readDatagrams(conn))
+}
+
+func TestSyslogWriter_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "unix://" + path, AppName: "audit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.host = "web-1"
+	w.send(&docker.APIEvents{Type: "image", Action: "pull", Actor: docker.APIActor{ID: "redis"}, Time: 1500000000}, nil)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{
+		fmt.Sprintf(`<30>1 2017-07-14T02:40:00.000000Z web-1 audit %d pull - image pull redis`, os.Getpid()),
+	}, readDatagrams(conn))
+}
+
+func TestSyslogWriter_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	records := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				close(records)
+				return
+			}
+			record := make([]byte, n)
+			if _, err := r.Read(record); err != nil {
+				close(records)
+				return
+			}
+			records <- string(record)
+		}
+	}()
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "tcp://" + l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range testAuditEvents()[:2] {
+		w.send(event, nil)
+	}
+	assert.NoError(t, w.Close())
+
+	var received []string
+	for r := range records {
+		received = append(received, r)
+	}
+	if assert.Len(t, received, 2) {
+		assert.True(t, strings.HasSuffix(received[0], " exec_start - container exec_start abc"), received[0])
+		assert.True(t, strings.HasSuffix(received[1], " die - container die abc"), received[1])
+	}
+}
+
+func TestSyslogConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config SyslogConfig
+		err    string
+	}{
+		{SyslogConfig{}, ""},
+		{SyslogConfig{Address: "udp://localhost:514", Format: "structured", Facility: "local0", Severity: "warning"}, ""},
+		{SyslogConfig{Format: "xml"}, `unknown syslog format "xml"`},
+		{SyslogConfig{Facility: "kernel"}, `unknown syslog facility "kernel"`},
+		{SyslogConfig{Severity: "fatal"}, `unknown syslog severity "fatal"`},
+		{SyslogConfig{Address: "http://localhost"}, `syslog address must be unix, udp or tcp, not "http"`},
+	}
+	for _, tt := range tests {
+		err := tt.config.validate()
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else if assert.Error(t, err) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
+
+func TestRecordWriter_Buffer(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := newRecordWriter("test", "udp", conn.LocalAddr().String(), nil)
+	w.limit = 3
+	dialing, release := make(chan bool), make(chan bool)
+	w.dial = func() (net.Conn, error) {
+		close(dialing)
+		<-release
+		return net.Dial("udp", conn.LocalAddr().String())
+	}
+
+	// While the log is unreachable, records are buffered without
+	// blocking, and dropped once the buffer is full.
+	w.write([]byte("0"))
+	<-dialing
+	for _, record := range []string{"1", "2", "3", "4", "5"} {
+		w.write([]byte(record))
+	}
+	close(release)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"0", "1", "2", "3"}, readDatagrams(conn))
+}
+
+func TestAuditLogs_Labels(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "labels": {},
+  "syslog": [{"address": "udp://` + conn.LocalAddr().String() + `", "events": {"container": ["exec_start"]}}],
+  "events": {
+    "container": {
+      "actions": {
+        "start": {},
+        "exec_start": {"exclude": {"name": ["db"]}}
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	// Containers can't keep their execs out of the audit log with
+	// labels, and neither do the action's filters.
+	source := &ReaderSource{Reader: strings.NewReader(`{"Type":"container","Action":"start","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"start"}}}
+{"Type":"container","Action":"exec_start: sh","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"start"}}}
+{"Type":"container","Action":"exec_start: sh","Actor":{"ID":"b","Attributes":{"name":"worker","dockerdog.ignore":"true"}}}
+{"Type":"container","Action":"exec_start: sh","Actor":{"ID":"c","Attributes":{"name":"db"}}}
+`)}
+	w, err := NewWatcher(config, s, WithSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Run(context.Background()))
+
+	assert.Equal(t, []string{"docker.events.container.start:1|c"}, packets(1))
+	var messages []string
+	for _, d := range readDatagrams(conn) {
+		messages = append(messages, d[strings.Index(d, " - ")+3:])
+	}
+	assert.Equal(t, []string{"container exec_start a", "container exec_start b", "container exec_start c"}, messages)
+}
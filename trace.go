@@ -0,0 +1,445 @@
+package dockerdog
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	defaultOTLPTracesURL      = "http://localhost:4318/v1/traces"
+	defaultTraceFlushInterval = 5 * time.Second
+	defaultTraceBatchSize     = 1000
+
+	// traceExpiryInterval is how often the traces of containers that no
+	// longer exist are expired.
+	traceExpiryInterval = time.Minute
+
+	// maxSpanEvents is the most events recorded on a span. Later events
+	// are counted as dropped.
+	maxSpanEvents = 128
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// TracesConfig configures exporting the lifecycle of each container as a
+// trace to an OpenTelemetry collector over OTLP/HTTP, with the JSON encoding.
+type TracesConfig struct {
+	// URL is the endpoint that traces are exported to.
+	URL string `json:"url"`
+
+	// ServiceName is the service.name resource attribute.
+	ServiceName string `json:"service_name"`
+
+	HTTPExportConfig
+}
+
+// traceEndActions are the actions that end a container's run and trace. They're
+// traced even when their action's filters exclude them, so that spans aren't
+// left open.
+var traceEndActions = []string{"die", "destroy"}
+
+// traceTap is a Processor that sends container events to a tracer, unless
+// their action's filters exclude them, whether or not they're reported.
+type traceTap struct {
+	eventTap
+	actions *actionFilter
+}
+
+// Process sends the event to the tracer, if it's traced.
+func (t *traceTap) Process(event *docker.APIEvents) bool {
+	action, _ := splitAction(event.Action)
+	if contains(traceEndActions, action) || t.actions.Process(event) {
+		t.eventTap.Process(event)
+	}
+	return true
+}
+
+// otlpSpanEvent is an event recorded on a span.
+type otlpSpanEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+// otlpStatus is the status of a span.
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// span is a span, in the OTLP/JSON format.
+type span struct {
+	TraceID            string          `json:"traceId"`
+	SpanID             string          `json:"spanId"`
+	ParentSpanID       string          `json:"parentSpanId,omitempty"`
+	Name               string          `json:"name"`
+	Kind               int             `json:"kind"`
+	StartTimeUnixNano  string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano    string          `json:"endTimeUnixNano"`
+	Attributes         []otlpAttribute `json:"attributes,omitempty"`
+	Events             []otlpSpanEvent `json:"events,omitempty"`
+	DroppedEventsCount int             `json:"droppedEventsCount,omitempty"`
+	Status             *otlpStatus     `json:"status,omitempty"`
+}
+
+// addEvent records an event on the span.
+func (s *span) addEvent(name string, t time.Time, tags []string) {
+	if len(s.Events) >= maxSpanEvents {
+		s.DroppedEventsCount++
+		return
+	}
+	s.Events = append(s.Events, otlpSpanEvent{
+		TimeUnixNano: otlpNanos(t),
+		Name:         name,
+		Attributes:   otlpAttributes(tags),
+	})
+}
+
+// setExitCode sets the span's status from an exit code.
+func (s *span) setExitCode(exitCode string) {
+	if exitCode == "" {
+		return
+	}
+	s.Attributes = append(s.Attributes, otlpString("exit_code", exitCode))
+	if exitCode == "0" {
+		s.Status = &otlpStatus{Code: spanStatusOK}
+	} else {
+		s.Status = &otlpStatus{Code: spanStatusError, Message: fmt.Sprintf("exited with code %s", exitCode)}
+	}
+}
+
+// containerTrace is the trace of a container's lifecycle, and its open spans.
+type containerTrace struct {
+	root  *span
+	run   *span
+	pause *span
+
+	// health is the span for the current health status.
+	health *span
+
+	// execs are the running exec sessions, by exec ID.
+	execs map[string]*span
+
+	// seen is when the container's last event was traced.
+	seen time.Time
+}
+
+// tracer is an eventSink that traces the lifecycle of containers: a root span
+// from create to destroy, with child spans for each run (start to die),
+// pause, exec session and health status. Spans are exported once they end;
+// spans that are still open on shutdown are dropped. The traces of containers
+// that are removed without a destroy event, e.g. while the event stream was
+// down, are expired, so that they don't leak.
+type tracer struct {
+	client   *retryingClient
+	url      string
+	headers  headerTemplates
+	resource map[string]interface{}
+	host     string
+
+	batchSize int
+
+	mu         sync.Mutex
+	containers map[string]*containerTrace
+	// finished are the spans that have ended, and haven't been exported.
+	finished []*span
+
+	// full is signalled when batchSize spans have ended.
+	full chan bool
+	done chan bool
+	wg   sync.WaitGroup
+}
+
+// newTracer returns a tracer, and starts exporting spans.
+func newTracer(c TracesConfig) (*tracer, error) {
+	headers, err := parseHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	e := c.HTTPExportConfig.defaults(defaultTraceFlushInterval, defaultTraceBatchSize)
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = defaultOTLPServiceName
+	}
+
+	t := &tracer{
+		client:     newRetryingClient(e.MaxRetries),
+		url:        c.URL,
+		headers:    headers,
+		batchSize:  e.BatchSize,
+		containers: make(map[string]*containerTrace),
+		full:       make(chan bool, 1),
+		done:       make(chan bool),
+	}
+	if t.url == "" {
+		t.url = defaultOTLPTracesURL
+	}
+	t.host, _ = os.Hostname()
+	t.resource = otlpResource(serviceName, t.host)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		flushLoop(e.FlushInterval.Duration, t.full, t.done, t.flush)
+	}()
+	return t, nil
+}
+
+// send updates the trace of the event's container.
+func (t *tracer) send(event *docker.APIEvents, tags []string) {
+	if event.Type != "container" || event.Actor.ID == "" {
+		return
+	}
+	now := time.Now()
+	if event.TimeNano != 0 || event.Time != 0 {
+		now = eventTime(event)
+	}
+	action, payload := splitAction(event.Action)
+	attributes := event.Actor.Attributes
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.containers[event.Actor.ID]
+	if !ok {
+		// Containers that were created before dockerdog started are
+		// traced from their first event.
+		c = t.newTrace(event, now, tags)
+		t.containers[event.Actor.ID] = c
+	}
+	// Payloads, like exec commands, aren't recorded, since they can
+	// contain secrets.
+	c.root.addEvent(action, now, nil)
+	c.seen = time.Now()
+
+	switch action {
+	case "start":
+		t.end(c.run, now)
+		c.run = t.child(c, "run", now, tags)
+	case "die":
+		t.endChildren(c, now)
+		if c.run != nil {
+			c.run.setExitCode(attributes["exitCode"])
+			t.end(c.run, now)
+			c.run = nil
+		}
+	case "oom", "kill":
+		if c.run != nil {
+			c.run.addEvent(action, now, tags)
+		}
+	case "pause":
+		t.end(c.pause, now)
+		c.pause = t.child(c, "pause", now, tags)
+	case "unpause":
+		t.end(c.pause, now)
+		c.pause = nil
+	case "exec_start":
+		id := attributes["execID"]
+		t.end(c.execs[id], now)
+		c.execs[id] = t.child(c, "exec", now, tags)
+	case "exec_die":
+		id := attributes["execID"]
+		if s := c.execs[id]; s != nil {
+			s.setExitCode(attributes["exitCode"])
+			t.end(s, now)
+			delete(c.execs, id)
+		}
+	case "health_status":
+		t.end(c.health, now)
+		c.health = t.child(c, "health: "+payload, now, tags)
+		if payload == "unhealthy" {
+			c.health.Status = &otlpStatus{Code: spanStatusError, Message: "unhealthy"}
+		}
+	case "destroy":
+		t.endTrace(c, now)
+		delete(t.containers, event.Actor.ID)
+	}
+}
+
+// endTrace ends the container's open spans, and its root span.
+func (t *tracer) endTrace(c *containerTrace, now time.Time) {
+	t.endChildren(c, now)
+	t.end(c.run, now)
+	t.end(c.root, now)
+}
+
+// expireLoop expires the traces of containers that no longer exist every
+// interval, until ctx is cancelled.
+func (t *tracer) expireLoop(ctx context.Context, api *daemonAPI, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+
+		listed := time.Now()
+		ids, err := containerIDs(ctx, api, interval)
+		if err != nil {
+			log.Printf("error listing containers to expire traces: %v", err)
+			continue
+		}
+		t.expire(ids, listed)
+	}
+}
+
+// containerIDs returns the IDs of the containers on the host, including
+// stopped ones. The request is bounded by timeout.
+func containerIDs(ctx context.Context, api *daemonAPI, timeout time.Duration) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var containers []docker.APIContainers
+	if err := api.getJSON(ctx, "/containers/json", url.Values{"all": {"1"}}, &containers); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		ids[c.ID] = true
+	}
+	return ids, nil
+}
+
+// expire ends the traces of containers that aren't in ids, which were listed
+// at listed. Containers whose events were traced after they were listed
+// aren't expired, since they may have been created since.
+func (t *tracer) expire(ids map[string]bool, listed time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, c := range t.containers {
+		if !ids[id] && c.seen.Before(listed) {
+			t.endTrace(c, now)
+			delete(t.containers, id)
+		}
+	}
+}
+
+// newTrace returns the trace for the event's container. Its IDs are derived
+// from the container ID, so that they're the same if dockerdog restarts.
+func (t *tracer) newTrace(event *docker.APIEvents, now time.Time, tags []string) *containerTrace {
+	id := sha256.Sum256([]byte(event.Actor.ID))
+	name := event.Actor.Attributes["name"]
+	if name == "" {
+		name = event.Actor.ID
+	}
+	root := &span{
+		TraceID:           hex.EncodeToString(id[:16]),
+		SpanID:            hex.EncodeToString(id[16:24]),
+		Name:              "container " + name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: otlpNanos(now),
+		Attributes:        append(otlpAttributes(tags), otlpString("container.id", event.Actor.ID)),
+	}
+	return &containerTrace{root: root, execs: make(map[string]*span)}
+}
+
+// child starts a span that's a child of the container's root span.
+func (t *tracer) child(c *containerTrace, name string, now time.Time, tags []string) *span {
+	var id [8]byte
+	rand.Read(id[:])
+	return &span{
+		TraceID:           c.root.TraceID,
+		SpanID:            hex.EncodeToString(id[:]),
+		ParentSpanID:      c.root.SpanID,
+		Name:              name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: otlpNanos(now),
+		Attributes:        otlpAttributes(tags),
+	}
+}
+
+// endChildren ends the spans that can't outlive a run: pauses, exec sessions
+// and health statuses.
+func (t *tracer) endChildren(c *containerTrace, now time.Time) {
+	t.end(c.pause, now)
+	t.end(c.health, now)
+	for id, s := range c.execs {
+		t.end(s, now)
+		delete(c.execs, id)
+	}
+	c.pause, c.health = nil, nil
+}
+
+// end ends the span, if it's open, and queues it to be exported.
+func (t *tracer) end(s *span, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.EndTimeUnixNano = otlpNanos(now)
+	t.finished = append(t.finished, s)
+	if len(t.finished) >= t.batchSize {
+		select {
+		case t.full <- true:
+		default:
+		}
+	}
+}
+
+// Close exports the spans that have ended.
+func (t *tracer) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	return nil
+}
+
+// flush exports the spans that have ended. Errors are logged, and the spans
+// that couldn't be exported are dropped.
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+
+	split(len(spans), t.batchSize, func(i, j int) {
+		if err := t.export(spans[i:j]); err != nil {
+			log.Printf("error exporting traces over OTLP: %v", err)
+		}
+	})
+}
+
+// export exports the spans.
+func (t *tracer) export(spans []*span) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": t.resource,
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": otlpScope,
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.client.post(t.url, body, func() (http.Header, error) {
+		h := http.Header{"Content-Type": {"application/json"}}
+		if err := t.headers.render(h, t.host); err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+}
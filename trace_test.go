@@ -0,0 +1,258 @@
+package dockerdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportedSpans returns the spans exported to the collector, by name.
+func exportedSpans(t *testing.T, bodies []string) map[string][]span {
+	spans := make(map[string][]span)
+	for _, body := range bodies {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = append(spans[s.Name], s)
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	collector := newFakeWebhook()
+	defer collector.Close()
+
+	tr, err := newTracer(TracesConfig{URL: collector.URL + "/v1/traces"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := func(action string, sec int64, attributes map[string]string) *docker.APIEvents {
+		a := map[string]string{"name": "web"}
+		for k, v := range attributes {
+			a[k] = v
+		}
+		return &docker.APIEvents{Type: "container", Action: action, Actor: docker.APIActor{ID: "abc", Attributes: a}, TimeNano: (1500000000 + sec) * int64(time.Second)}
+	}
+	tags := []string{"name:web"}
+	for _, event := range []*docker.APIEvents{
+		web("create", 0, nil),
+		web("start", 1, nil),
+		web("health_status: healthy", 2, nil),
+		web("exec_start: /bin/sh -c 'echo secret'", 3, map[string]string{"execID": "e1"}),
+		web("exec_die", 4, map[string]string{"execID": "e1", "exitCode": "0"}),
+		web("pause", 5, nil),
+		web("unpause", 6, nil),
+		web("health_status: unhealthy", 7, nil),
+		web("kill", 8, map[string]string{"signal": "9"}),
+		web("die", 9, map[string]string{"exitCode": "137"}),
+		web("start", 10, nil),
+		{Type: "image", Action: "pull", Actor: docker.APIActor{ID: "redis"}},
+	} {
+		tr.send(event, tags)
+	}
+	// The second run hasn't finished, and the container hasn't been
+	// destroyed, so only the first run's spans are exported.
+	tr.flush()
+	tr.send(web("die", 11, map[string]string{"exitCode": "0"}), tags)
+	tr.send(web("destroy", 12, nil), tags)
+	assert.NoError(t, tr.Close())
+
+	_, bodies := collector.received()
+	assert.Len(t, bodies, 2)
+	spans := exportedSpans(t, bodies)
+
+	if !assert.Len(t, spans["container web"], 1) {
+		return
+	}
+	root := spans["container web"][0]
+	assert.Len(t, root.TraceID, 32)
+	assert.Len(t, root.SpanID, 16)
+	assert.Equal(t, "", root.ParentSpanID)
+	assert.Equal(t, "1500000000000000000", root.StartTimeUnixNano)
+	assert.Equal(t, "1500000012000000000", root.EndTimeUnixNano)
+	assert.Equal(t, []otlpAttribute{otlpString("name", "web"), otlpString("container.id", "abc")}, root.Attributes)
+	var names []string
+	for _, e := range root.Events {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"create", "start", "health_status", "exec_start", "exec_die", "pause", "unpause", "health_status", "kill", "die", "start", "die", "destroy"}, names)
+
+	for name, s := range spans {
+		assert.Equal(t, root.TraceID, s[0].TraceID, name)
+		if name != "container web" {
+			assert.Equal(t, root.SpanID, s[0].ParentSpanID, name)
+		}
+	}
+
+	runs := spans["run"]
+	if assert.Len(t, runs, 2) {
+		assert.Equal(t, "1500000001000000000", runs[0].StartTimeUnixNano)
+		assert.Equal(t, "1500000009000000000", runs[0].EndTimeUnixNano)
+		assert.Equal(t, &otlpStatus{Code: spanStatusError, Message: "exited with code 137"}, runs[0].Status)
+		assert.Equal(t, "kill", runs[0].Events[0].Name)
+		assert.Equal(t, &otlpStatus{Code: spanStatusOK}, runs[1].Status)
+	}
+
+	if assert.Len(t, spans["exec"], 1) {
+		assert.Equal(t, "1500000003000000000", spans["exec"][0].StartTimeUnixNano)
+		assert.Equal(t, "1500000004000000000", spans["exec"][0].EndTimeUnixNano)
+		assert.Equal(t, &otlpStatus{Code: spanStatusOK}, spans["exec"][0].Status)
+	}
+
+	if assert.Len(t, spans["pause"], 1) {
+		assert.Equal(t, "1500000005000000000", spans["pause"][0].StartTimeUnixNano)
+		assert.Equal(t, "1500000006000000000", spans["pause"][0].EndTimeUnixNano)
+	}
+
+	if assert.Len(t, spans["health: healthy"], 1) {
+		assert.Equal(t, "1500000007000000000", spans["health: healthy"][0].EndTimeUnixNano)
+	}
+	if assert.Len(t, spans["health: unhealthy"], 1) {
+		assert.Equal(t, "1500000009000000000", spans["health: unhealthy"][0].EndTimeUnixNano)
+		assert.Equal(t, spanStatusError, spans["health: unhealthy"][0].Status.Code)
+	}
+}
+
+func TestTracer_SameTraceAcrossRestarts(t *testing.T) {
+	a, err := newTracer(TracesConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	event := &docker.APIEvents{Type: "container", Action: "start", Actor: docker.APIActor{ID: "abc"}}
+	assert.Equal(t, a.newTrace(event, time.Now(), nil).root.TraceID, a.newTrace(event, time.Now(), nil).root.TraceID)
+	assert.Equal(t, "container abc", a.newTrace(event, time.Now(), nil).root.Name)
+}
+
+func TestTracer_UnreportedEvents(t *testing.T) {
+	collector := newFakeWebhook()
+	defer collector.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "labels": {},
+  "traces": {"url": "` + collector.URL + `/v1/traces"},
+  "exclude": {"image": ["k8s.gcr.io/pause*"]},
+  "events": {
+    "container": {
+      "actions": {
+        "die": {},
+        "destroy": {"exclude": {"name": ["worker"]}},
+        "exec_start": {"exclude": {"payload": ["/bin/sh -c curl -f *"]}}
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	// The web container only reports die, and the worker's destroy is
+	// excluded, but both of their traces end when they're destroyed.
+	// Excluded containers and execs aren't traced.
+	source := &ReaderSource{Reader: strings.NewReader(`{"Type":"container","Action":"create","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"die"}}}
+{"Type":"container","Action":"start","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"die"}}}
+{"Type":"container","Action":"exec_start: /bin/sh -c curl -f localhost","Actor":{"ID":"a","Attributes":{"name":"web","execID":"e1","dockerdog.events":"die"}}}
+{"Type":"container","Action":"exec_die","Actor":{"ID":"a","Attributes":{"name":"web","execID":"e1","exitCode":"0","dockerdog.events":"die"}}}
+{"Type":"container","Action":"exec_start: bash","Actor":{"ID":"a","Attributes":{"name":"web","execID":"e2","dockerdog.events":"die"}}}
+{"Type":"container","Action":"exec_die","Actor":{"ID":"a","Attributes":{"name":"web","execID":"e2","exitCode":"0","dockerdog.events":"die"}}}
+{"Type":"container","Action":"die","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"die"}}}
+{"Type":"container","Action":"destroy","Actor":{"ID":"a","Attributes":{"name":"web","dockerdog.events":"die"}}}
+{"Type":"container","Action":"create","Actor":{"ID":"b","Attributes":{"name":"worker"}}}
+{"Type":"container","Action":"destroy","Actor":{"ID":"b","Attributes":{"name":"worker"}}}
+{"Type":"container","Action":"create","Actor":{"ID":"c","Attributes":{"name":"pause","image":"k8s.gcr.io/pause:3.1"}}}
+`)}
+	w, err := NewWatcher(config, s, WithSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Run(context.Background()))
+
+	assert.Equal(t, []string{"docker.events.container.create:1|c", "docker.events.container.die:1|c"}, packets(2))
+	assert.Empty(t, w.tracer.containers)
+	_, bodies := collector.received()
+	spans := exportedSpans(t, bodies)
+	assert.Len(t, spans["container web"], 1)
+	assert.Len(t, spans["container worker"], 1)
+	assert.Len(t, spans["exec"], 1)
+	assert.Len(t, spans["run"], 1)
+}
+
+func TestTracer_Expire(t *testing.T) {
+	collector := newFakeWebhook()
+	defer collector.Close()
+
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.24/containers/json", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("all"))
+		fmt.Fprintln(w, `[{"Id":"b","State":"running"}]`)
+	}))
+	defer daemon.Close()
+
+	tr, err := newTracer(TracesConfig{URL: collector.URL + "/v1/traces"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		tr.send(&docker.APIEvents{Type: "container", Action: "start", Actor: docker.APIActor{ID: id, Attributes: map[string]string{"name": id}}}, nil)
+	}
+
+	// A container that's traced after it was listed isn't expired, since
+	// it may have been created since.
+	tr.expire(map[string]bool{}, time.Now().Add(-time.Minute))
+	assert.Len(t, tr.containers, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		tr.expireLoop(ctx, newTestEventStream(t, daemon.URL, nil).api, 10*time.Millisecond)
+		close(done)
+	}()
+	for i := 0; ; i++ {
+		tr.mu.Lock()
+		n := len(tr.containers)
+		tr.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("trace wasn't expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	assert.NoError(t, tr.Close())
+
+	_, bodies := collector.received()
+	spans := exportedSpans(t, bodies)
+	// The expired container's run and root spans end.
+	assert.Len(t, spans["container a"], 1)
+	assert.Len(t, spans["run"], 1)
+	assert.Empty(t, spans["container b"])
+	assert.NotNil(t, tr.containers["b"])
+}
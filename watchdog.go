@@ -0,0 +1,277 @@
+package dockerdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// defaultWatchdogInterval and defaultWatchdogTimeout are used when
+	// the watchdog config omits interval or timeout.
+	defaultWatchdogInterval = 30 * time.Second
+	defaultWatchdogTimeout  = 10 * time.Minute
+
+	// minReconnectBackoff and maxReconnectBackoff bound how long to wait
+	// before reconnecting after the event stream fails.
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// Reasons for reconnecting to the event stream, reported as the reason tag
+// of dockerdog.stream.reconnects.
+const (
+	reconnectClosed   = "closed"
+	reconnectError    = "error"
+	reconnectSilence  = "silence"
+	reconnectActivity = "activity"
+)
+
+// WatchdogConfig configures detecting, and recovering from, stalled event
+// streams.
+type WatchdogConfig struct {
+	// Interval is how often the daemon is pinged, and container activity
+	// is compared with the events received.
+	Interval Duration `json:"interval"`
+
+	// Timeout is the longest that the event stream can be silent before
+	// it's reconnected, when container activity can't be compared with
+	// the events received.
+	Timeout Duration `json:"timeout"`
+}
+
+// supervisor streams events from the daemon, reconnecting when the stream is
+// closed, fails, or stalls. A stream is considered stalled when containers
+// have changed state without any events being received, or, when container
+// activity can't be compared with the events received, when no events have
+// been received for the watchdog timeout.
+type supervisor struct {
+	stream *eventStream
+	sink   Sink
+
+	interval, timeout time.Duration
+
+	// since and until are passed to the stream, which ends once until is
+	// reached.
+	since, until time.Time
+
+	// activityFilters are used to list the containers that are expected
+	// to produce events, or nil if container activity can't be compared
+	// with the events received.
+	activityFilters map[string][]string
+}
+
+func newSupervisor(stream *eventStream, s Sink, config WatchdogConfig, since, until time.Time) *supervisor {
+	sup := &supervisor{
+		stream:          stream,
+		sink:            s,
+		interval:        config.Interval.Duration,
+		timeout:         config.Timeout.Duration,
+		since:           since,
+		until:           until,
+		activityFilters: activityFilters(stream.filters),
+	}
+	if sup.interval <= 0 {
+		sup.interval = defaultWatchdogInterval
+	}
+	if sup.timeout <= 0 {
+		sup.timeout = defaultWatchdogTimeout
+	}
+	return sup
+}
+
+// Events sends events to ch until ctx is cancelled, or until is reached.
+// Reconnections resume from the last event received, so events aren't lost.
+func (s *supervisor) Events(ctx context.Context, ch chan<- *docker.APIEvents) error {
+	backoff := minReconnectBackoff
+	since := s.since
+
+	// lastNano is the time of the last event received, used to skip
+	// events that are sent again after reconnecting.
+	var lastNano int64
+
+	for {
+		connected := time.Now()
+		if since.IsZero() {
+			since = connected
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		events := make(chan *docker.APIEvents)
+		errc := make(chan error, 1)
+		go func(since time.Time) {
+			errc <- s.stream.Stream(streamCtx, since, s.until, events)
+		}(since)
+
+		reason, err := s.watch(ctx, events, errc, ch, &lastNano, &since)
+		cancel()
+		if reason == "" {
+			return err
+		}
+
+		if err != nil {
+			log.Printf("reconnecting to event stream (%s): %v", reason, err)
+		} else {
+			log.Printf("reconnecting to event stream (%s)", reason)
+		}
+		s.sink.Count("dockerdog.stream.reconnects", 1, []string{fmt.Sprintf("reason:%s", reason)}, 1)
+
+		// Stalled streams are reconnected immediately, but failing
+		// ones back off, since the daemon is likely unavailable.
+		if reason == reconnectClosed || reason == reconnectError {
+			if time.Since(connected) > maxReconnectBackoff {
+				backoff = minReconnectBackoff
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil
+			}
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+		}
+	}
+}
+
+// watch forwards events from a single connection to ch, and returns the
+// reason to reconnect, or an empty reason if the stream ended normally.
+func (s *supervisor) watch(ctx context.Context, events <-chan *docker.APIEvents, errc <-chan error, ch chan<- *docker.APIEvents, lastNano *int64, since *time.Time) (string, error) {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	lastEvent := time.Now()
+	snapshot, snapshotOK := s.snapshot(ctx)
+	snapshotAt := time.Now()
+
+	for {
+		select {
+		case event := <-events:
+			lastEvent = time.Now()
+			if event.TimeNano != 0 {
+				if event.TimeNano <= *lastNano {
+					continue
+				}
+				*lastNano = event.TimeNano
+			}
+			*since = eventTime(event)
+
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return "", <-errc
+			}
+		case err := <-errc:
+			switch {
+			case err == errEventStreamClosed:
+				return reconnectClosed, nil
+			case err != nil:
+				return reconnectError, err
+			}
+			// The stream ends without error when ctx is cancelled,
+			// or until is reached.
+			return "", nil
+		case now := <-t.C:
+			if err := s.ping(ctx); err != nil {
+				log.Printf("watchdog could not ping the Docker daemon: %v", err)
+				s.sink.Count("dockerdog.watchdog.ping_errors", 1, nil, 1)
+				continue
+			}
+
+			current, ok := s.snapshot(ctx)
+			if !ok {
+				// Without container activity to compare with, a
+				// long silence is the only sign of a stall.
+				if now.Sub(lastEvent) >= s.timeout {
+					return reconnectSilence, nil
+				}
+			} else if snapshotOK && current != snapshot && lastEvent.Before(snapshotAt) {
+				return reconnectActivity, nil
+			}
+			snapshot, snapshotOK, snapshotAt = current, ok, now
+		case <-ctx.Done():
+			return "", <-errc
+		}
+	}
+}
+
+// ping pings the daemon. A daemon that doesn't respond within the watchdog
+// interval is considered unavailable.
+func (s *supervisor) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+	return s.stream.api.ping(ctx)
+}
+
+// snapshot returns a fingerprint of the state of the containers that are
+// expected to produce events, and false if it can't be determined within the
+// watchdog interval.
+func (s *supervisor) snapshot(ctx context.Context) (string, bool) {
+	if s.activityFilters == nil {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+	filters, _ := json.Marshal(s.activityFilters)
+	var containers []docker.APIContainers
+	err := s.stream.api.getJSON(ctx, "/containers/json", url.Values{
+		"all":     {"1"},
+		"filters": {string(filters)},
+	}, &containers)
+	if err != nil {
+		log.Printf("watchdog could not list containers: %v", err)
+		return "", false
+	}
+
+	states := make([]string, 0, len(containers))
+	for _, c := range containers {
+		state := c.State
+		if state == "" {
+			// Older daemons only report a human readable status,
+			// like "Up 5 minutes", which changes over time.
+			state = fmt.Sprintf("%t", strings.HasPrefix(c.Status, "Up"))
+		}
+		states = append(states, c.ID+":"+state)
+	}
+	sort.Strings(states)
+	return strings.Join(states, ","), true
+}
+
+// activityFilters returns the filters to list containers with, that should
+// produce events with the given event filters, or nil if container events
+// aren't being streamed, or are filtered in ways that listing containers
+// can't reproduce. Without a type filter, every type is streamed. An event
+// filter is fine, as long as it includes the actions that change the state of
+// containers.
+func activityFilters(filters map[string][]string) map[string][]string {
+	if types, ok := filters["type"]; ok && !contains(types, "container") {
+		return nil
+	}
+
+	activity := make(map[string][]string)
+	for k, v := range filters {
+		switch k {
+		case "type":
+		case "event":
+			for _, a := range containerStateActions {
+				if !contains(v, a) {
+					return nil
+				}
+			}
+		case "label":
+			activity[k] = v
+		default:
+			return nil
+		}
+	}
+	return activity
+}
@@ -0,0 +1,169 @@
+package dockerdog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor_Reconnect(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		sinces []string
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/events") {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		n := len(sinces)
+		mu.Unlock()
+
+		fmt.Fprintln(w, `{"Type":"container","Action":"start","time":1470000000,"timeNano":1470000000000000000}`)
+		if n == 1 {
+			// Close the stream after the first event.
+			return
+		}
+		// The first event is sent again, since it's in the second
+		// that the stream resumes from.
+		fmt.Fprintln(w, `{"Type":"container","Action":"die","time":1470000001,"timeNano":1470000001000000000}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	statsd, packets := newTestStatsd(t)
+	defer statsd.Close()
+
+	sup := newSupervisor(newTestEventStream(t, s.URL, nil), statsd, WatchdogConfig{}, time.Time{}, time.Time{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *docker.APIEvents)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- sup.Events(ctx, events)
+	}()
+
+	assert.Equal(t, "start", (<-events).Action)
+	assert.Equal(t, "die", (<-events).Action)
+	cancel()
+	assert.NoError(t, <-errc)
+
+	assert.Equal(t, []string{"dockerdog.stream.reconnects:1|c|#reason:closed"}, packets(1))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "1470000000", sinces[1])
+}
+
+func TestSupervisor_HungDaemon(t *testing.T) {
+	// The daemon accepts requests, but never responds to pings or
+	// container lists.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/events") {
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	statsd, packets := newTestStatsd(t)
+	defer statsd.Close()
+
+	sup := newSupervisor(newTestEventStream(t, s.URL, nil), statsd, WatchdogConfig{Interval: Duration{50 * time.Millisecond}}, time.Time{}, time.Time{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- sup.Events(ctx, make(chan *docker.APIEvents))
+	}()
+
+	// Pings that time out are counted as errors, and don't stop the
+	// watchdog.
+	assert.Equal(t, []string{
+		"dockerdog.watchdog.ping_errors:1|c",
+		"dockerdog.watchdog.ping_errors:1|c",
+	}, packets(2))
+	cancel()
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("supervisor didn't return when cancelled")
+	}
+}
+
+func TestSupervisor_Silence(t *testing.T) {
+	for _, list := range []bool{true, false} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/events"):
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			case strings.HasSuffix(r.URL.Path, "/containers/json") && list:
+				fmt.Fprintln(w, `[]`)
+			case strings.HasSuffix(r.URL.Path, "/_ping"):
+				fmt.Fprint(w, "OK")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		capture := newFakeStatsd(t)
+		statsd, err := NewStatsdSink(capture.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sup := newSupervisor(newTestEventStream(t, s.URL, nil), statsd, WatchdogConfig{
+			Interval: Duration{10 * time.Millisecond},
+			Timeout:  Duration{30 * time.Millisecond},
+		}, time.Time{}, time.Time{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() {
+			errc <- sup.Events(ctx, make(chan *docker.APIEvents))
+		}()
+
+		if list {
+			// A quiet host isn't reconnected, as long as containers
+			// don't change state.
+			time.Sleep(200 * time.Millisecond)
+			assert.Empty(t, capture.packets())
+		} else {
+			// Without container activity to compare with, silence
+			// reconnects the stream.
+			buf := make([]byte, 65536)
+			capture.conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := capture.conn.ReadFrom(buf)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "dockerdog.stream.reconnects:1|c|#reason:silence", string(buf[:n]))
+			}
+		}
+		cancel()
+		assert.NoError(t, <-errc)
+
+		statsd.Close()
+		capture.Close()
+		s.Close()
+	}
+}
+
+func TestActivityFilters(t *testing.T) {
+	assert.Nil(t, activityFilters(map[string][]string{"type": {"image"}}))
+	assert.Equal(t, map[string][]string{}, activityFilters(map[string][]string{}))
+	assert.Nil(t, activityFilters(map[string][]string{"type": {"container"}, "event": {"die"}}))
+	assert.Equal(t, map[string][]string{}, activityFilters(map[string][]string{"type": {"container"}, "event": append([]string{"exec_start"}, containerStateActions...)}))
+	assert.Equal(t, map[string][]string{}, activityFilters(map[string][]string{"type": {"container", "image"}}))
+	assert.Equal(t, map[string][]string{"label": {"team=payments"}}, activityFilters(map[string][]string{"type": {"container"}, "label": {"team=payments"}}))
+}
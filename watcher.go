@@ -0,0 +1,314 @@
+package dockerdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// EventSource is a source of Docker events.
+type EventSource interface {
+	// Events sends events to ch until ctx is cancelled, or the source is
+	// exhausted.
+	Events(ctx context.Context, ch chan<- *docker.APIEvents) error
+}
+
+// Processor processes each event before it's reported. Processors can modify
+// the event, e.g. to add attributes, or drop it by returning false, in which
+// case it isn't seen by later processors, or reported. When the queue is
+// configured with more than one worker, events for different containers are
+// processed concurrently.
+type Processor interface {
+	Process(event *docker.APIEvents) bool
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(event *docker.APIEvents) bool
+
+// Process calls f(event).
+func (f ProcessorFunc) Process(event *docker.APIEvents) bool {
+	return f(event)
+}
+
+// Option configures a Watcher.
+type Option func(*Watcher)
+
+// WithSource reads events from source, instead of streaming them from the
+// Docker daemon. Features that query the daemon, like stats, inventory and
+// daemon health, are disabled.
+func WithSource(source EventSource) Option {
+	return func(w *Watcher) {
+		w.source = source
+	}
+}
+
+// WithProcessor adds a processor, which runs after any previously added
+// processors, and before events are reported.
+func WithProcessor(p Processor) Option {
+	return func(w *Watcher) {
+		w.processors = append(w.processors, p)
+	}
+}
+
+// WithSince streams past events from the daemon, starting at since.
+func WithSince(since time.Time) Option {
+	return func(w *Watcher) {
+		w.since = since
+	}
+}
+
+// WithUntil stops streaming events from the daemon once until is reached.
+func WithUntil(until time.Time) Option {
+	return func(w *Watcher) {
+		w.until = until
+	}
+}
+
+// Watcher reports Docker events, and the metrics derived from them, to a
+// Sink.
+type Watcher struct {
+	config *Config
+	sink   Sink
+	source EventSource
+
+	// processors run in order for each event. The last is the reporter.
+	processors []Processor
+	reporter   *reporter
+
+	// client and api are nil when events aren't read from the daemon.
+	client *docker.Client
+	api    *daemonAPI
+
+	// outputs are the event sinks, which are closed when Run returns.
+	outputs []eventSink
+
+	// tracer is nil when traces are disabled.
+	tracer *tracer
+
+	since, until time.Time
+
+	// inventory is nil when inventory collection is disabled.
+	inventory *inventoryCollector
+
+	// daemon is nil when daemon health collection is disabled.
+	daemon *daemonCollector
+}
+
+// NewWatcher returns a Watcher that reports to sink, as configured by config.
+// Unless WithSource is given, events are streamed from the Docker daemon
+// configured in config.Docker. Outputs configured by config, like webhooks,
+// are closed when Run returns.
+func NewWatcher(config *Config, sink Sink, opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		config:   config,
+		sink:     sink,
+		reporter: newReporter(config, sink),
+	}
+	outputs, err := newEventSinks(config)
+	if err != nil {
+		return nil, err
+	}
+	w.reporter.outputs = outputs
+	w.outputs = outputs
+	audit, err := newAuditLogs(config)
+	if err != nil {
+		closeEventSinks(w.outputs)
+		return nil, err
+	}
+	w.outputs = append(w.outputs, audit...)
+	if config.Traces != nil {
+		t, err := newTracer(*config.Traces)
+		if err != nil {
+			closeEventSinks(w.outputs)
+			return nil, fmt.Errorf("error configuring traces: %v", err)
+		}
+		w.tracer = t
+		w.outputs = append(w.outputs, t)
+	}
+
+	if config.Labels != nil {
+		w.processors = append(w.processors, newLabelProcessor(w.reporter.labels))
+	}
+	if len(audit) > 0 {
+		// Audit logs record every event, even those of containers
+		// that opt out of being reported with labels.
+		w.processors = append(w.processors, &eventTap{reporter: w.reporter, sinks: audit})
+	}
+	if config.Labels != nil {
+		// Ignored containers are dropped before any other processors.
+		w.processors = append(w.processors, &ignoreFilter{labels: w.reporter.labels})
+	}
+	w.processors = append(w.processors, &containerFilter{config: config})
+	if w.tracer != nil {
+		// Traces see the events of containers even when they aren't
+		// reported, so that they end when the container is destroyed.
+		w.processors = append(w.processors, &traceTap{
+			eventTap: eventTap{reporter: w.reporter, sinks: []eventSink{w.tracer}},
+			actions:  &actionFilter{config: config},
+		})
+	}
+	w.processors = append(w.processors, &actionFilter{config: config})
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.processors = append(w.processors, w.reporter)
+
+	if w.source != nil {
+		// Without a daemon, only the events themselves can be reported.
+		for name, enabled := range map[string]bool{
+			"stats":     config.Stats != nil,
+			"inventory": config.Inventory != nil,
+			"daemon":    config.Daemon != nil,
+		} {
+			if enabled {
+				log.Printf("ignoring %s config, which requires the Docker daemon", name)
+			}
+		}
+		return w, nil
+	}
+
+	c, api, err := newDockerClient(config.Docker)
+	if err != nil {
+		closeEventSinks(w.outputs)
+		return nil, fmt.Errorf("could not connect to Docker daemon: %v", err)
+	}
+	w.client, w.api = c, api
+
+	if config.Stats != nil {
+		w.reporter.stats = newStatsCollector(c, config, sink)
+	}
+	if config.Inventory != nil {
+		w.inventory = newInventoryCollector(c, api, sink, *config.Inventory)
+	}
+	if config.Daemon != nil {
+		w.daemon = newDaemonCollector(api, sink, *config.Daemon)
+	}
+	w.source = newSupervisor(newEventStream(api, eventFilters(config)), sink, config.Watchdog, w.since, w.until)
+	return w, nil
+}
+
+// Run reports events until ctx is cancelled, or the source ends. When ctx is
+// cancelled, events that are already in flight are reported before Run
+// returns. The sink isn't closed.
+func (w *Watcher) Run(ctx context.Context) error {
+	// Outputs are closed once everything else has stopped, so that they
+	// send every event.
+	defer closeEventSinks(w.outputs)
+
+	// Background collection stops, and is waited for, when Run returns.
+	var wg sync.WaitGroup
+	bgCtx, cancelBg := context.WithCancel(ctx)
+	defer func() {
+		cancelBg()
+		wg.Wait()
+	}()
+	background := func(f func(context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(bgCtx)
+		}()
+	}
+
+	if w.config.ServiceChecks != nil && w.api != nil {
+		background(func(ctx context.Context) {
+			checkDaemon(ctx, w.api, w.sink, *w.config.ServiceChecks)
+		})
+	}
+	if w.inventory != nil {
+		background(w.inventory.run)
+	}
+	if w.daemon != nil {
+		background(w.daemon.run)
+	}
+	if w.tracer != nil && w.api != nil {
+		background(func(ctx context.Context) {
+			w.tracer.expireLoop(ctx, w.api, traceExpiryInterval)
+		})
+	}
+
+	// The source isn't cancelled with ctx, so that in-flight events can
+	// be drained on shutdown.
+	sourceCtx, cancelSource := context.WithCancel(context.Background())
+	defer cancelSource()
+
+	events := make(chan *docker.APIEvents)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.source.Events(sourceCtx, events)
+	}()
+
+	if stats := w.reporter.stats; stats != nil {
+		defer stats.stopAll()
+		if err := stats.startRunning(); err != nil {
+			cancelSource()
+			<-errc
+			return err
+		}
+	}
+
+	var tick <-chan time.Time
+	if w.reporter.crashLoops != nil {
+		t := time.NewTicker(crashLoopInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var (
+		q         *eventQueue
+		queueTick <-chan time.Time
+	)
+	dispatch := w.process
+	if w.config.Queue != nil {
+		// Queued events are processed before stats collection is
+		// stopped.
+		q = newEventQueue(*w.config.Queue, w.sink, w.process)
+		defer q.close()
+		dispatch = q.push
+
+		t := time.NewTicker(queueInterval)
+		defer t.Stop()
+		queueTick = t.C
+	}
+
+	for {
+		select {
+		case event := <-events:
+			dispatch(event)
+		case err := <-errc:
+			return err
+		case now := <-tick:
+			w.reporter.reportCrashLoops(now)
+		case <-queueTick:
+			q.reportDepth()
+		case <-ctx.Done():
+			cancelSource()
+			return drain(dispatch, events, errc)
+		}
+	}
+}
+
+// process runs the processors for the event, until one drops it.
+func (w *Watcher) process(event *docker.APIEvents) {
+	for _, p := range w.processors {
+		if !p.Process(event) {
+			return
+		}
+	}
+}
+
+// drain dispatches any in-flight events until the cancelled source returns.
+func drain(dispatch func(*docker.APIEvents), events <-chan *docker.APIEvents, errc <-chan error) error {
+	for {
+		select {
+		case event := <-events:
+			dispatch(event)
+		case err := <-errc:
+			return err
+		}
+	}
+}
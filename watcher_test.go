@@ -0,0 +1,166 @@
+package dockerdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_Processors(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+  "attributes": {
+    "team": true
+  },
+  "events": {
+    "container": {
+      "actions": {
+        "start": {}
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	source := &ReaderSource{Reader: strings.NewReader(`{"Type":"container","Action":"start","Actor":{"ID":"abcd","Attributes":{"name":"web"}}}
+{"Type":"container","Action":"start","Actor":{"ID":"efgh","Attributes":{"name":"debug"}}}
+`)}
+
+	var seen []string
+	w, err := NewWatcher(config, s,
+		WithSource(source),
+		WithProcessor(ProcessorFunc(func(event *docker.APIEvents) bool {
+			return event.Actor.Attributes["name"] != "debug"
+		})),
+		WithProcessor(ProcessorFunc(func(event *docker.APIEvents) bool {
+			seen = append(seen, event.Actor.ID)
+			event.Actor.Attributes["team"] = "payments"
+			return true
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Run(context.Background()))
+
+	// Dropped events aren't seen by later processors, or reported.
+	assert.Equal(t, []string{"abcd"}, seen)
+	assert.Equal(t, []string{"docker.events.container.start:1|c|#team:payments"}, packets(1))
+}
+
+// inFlightSource sends its first event, and the rest once it's cancelled, like
+// a stream with events in flight when dockerdog is asked to shut down.
+type inFlightSource struct {
+	events  []*docker.APIEvents
+	started chan bool
+}
+
+func (s *inFlightSource) Events(ctx context.Context, ch chan<- *docker.APIEvents) error {
+	ch <- s.events[0]
+	close(s.started)
+	<-ctx.Done()
+	for _, event := range s.events[1:] {
+		ch <- event
+	}
+	return nil
+}
+
+func TestWatcher_Shutdown(t *testing.T) {
+	hook := newFakeWebhook()
+	defer hook.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "queue": {"size": 10, "workers": 2},
+  "webhooks": [{"url": "` + hook.URL + `", "flush_interval": "1h"}],
+  "events": {"container": {"actions": {"start": {}}}}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	source := &inFlightSource{started: make(chan bool)}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		source.events = append(source.events, &docker.APIEvents{Type: "container", Action: "start", Actor: docker.APIActor{ID: id}})
+	}
+
+	w, err := NewWatcher(config, s,
+		WithSource(source),
+		// Events are processed slowly, so that they're still queued
+		// when Run is cancelled.
+		WithProcessor(ProcessorFunc(func(event *docker.APIEvents) bool {
+			time.Sleep(20 * time.Millisecond)
+			return true
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- w.Run(ctx) }()
+	<-source.started
+	cancel()
+	assert.NoError(t, <-errc)
+
+	// Every event, including those in flight and queued at shutdown, is
+	// reported, and the webhook's batch is sent before Run returns.
+	assert.Equal(t, []string{
+		"docker.events.container.start:1|c",
+		"docker.events.container.start:1|c",
+		"docker.events.container.start:1|c",
+		"docker.events.container.start:1|c",
+	}, packets(4))
+	_, bodies := hook.received()
+	var sent int
+	for _, body := range bodies {
+		var batch []interface{}
+		if err := json.Unmarshal([]byte(body), &batch); err != nil {
+			t.Fatal(err)
+		}
+		sent += len(batch)
+	}
+	assert.Equal(t, 4, sent)
+}
+
+func TestWatcher_Shutdown_IdleReader(t *testing.T) {
+	r, pw := io.Pipe()
+	defer pw.Close()
+
+	s, packets := newTestStatsd(t)
+	defer s.Close()
+
+	w, err := NewWatcher(testConfig(t), s, WithSource(&ReaderSource{Reader: r}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- w.Run(ctx) }()
+
+	// Run returns on shutdown, even though the reader has no more events.
+	fmt.Fprintln(pw, `{"Type":"container","Action":"start","Actor":{"ID":"a"},"time":1470000000}`)
+	assert.Equal(t, []string{"docker.events.container.start:1|c"}, packets(1))
+	cancel()
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return")
+	}
+}
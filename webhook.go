@@ -0,0 +1,389 @@
+package dockerdog
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+const (
+	defaultWebhookBatchSize     = 100
+	defaultWebhookFlushInterval = 5 * time.Second
+	defaultWebhookSpoolLimit    = 1000
+
+	// webhookSignatureHeader is the header that signed requests carry the
+	// HMAC-SHA256 of their body in.
+	webhookSignatureHeader = "X-Dockerdog-Signature"
+)
+
+// Formats of webhook requests.
+const (
+	webhookJSON        = "json"
+	webhookCloudEvents = "cloudevents"
+)
+
+// WebhookConfig configures POSTing batches of events, with the tags that
+// they're counted with, to an HTTP endpoint.
+type WebhookConfig struct {
+	// URL is the endpoint that events are POSTed to.
+	URL string `json:"url"`
+
+	// Format is json (the default), which sends an array of events, or
+	// cloudevents, which sends a batch of CloudEvents.
+	Format string `json:"format"`
+
+	// Events selects the events that are sent, by type and action, e.g.
+	// {"container": ["start", "die"]}. All events are sent by default.
+	Events map[string][]string `json:"events"`
+
+	// SecretFile or SecretEnv enable signing requests with a secret read
+	// from a file or environment variable. The X-Dockerdog-Signature
+	// header is set to "sha256=" and the hex HMAC-SHA256 of the body.
+	SecretFile string `json:"secret_file"`
+	SecretEnv  string `json:"secret_env"`
+
+	// SpoolDir enables keeping the batches that couldn't be sent in a
+	// directory, to send them once the endpoint is back up. At most
+	// SpoolLimit batches are kept; the oldest are dropped first.
+	SpoolDir   string `json:"spool_dir"`
+	SpoolLimit int    `json:"spool_limit"`
+
+	HTTPExportConfig
+}
+
+// validate returns an error if the webhook is misconfigured.
+func (c *WebhookConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("webhook has no url")
+	}
+	switch c.Format {
+	case "", webhookJSON, webhookCloudEvents:
+	default:
+		return fmt.Errorf("unknown webhook format %q", c.Format)
+	}
+	if _, err := parseHeaders(c.Headers); err != nil {
+		return fmt.Errorf("invalid webhook %v", err)
+	}
+	return nil
+}
+
+// webhookEvent is an event in the body of a webhook request.
+type webhookEvent struct {
+	Event *docker.APIEvents `json:"event"`
+	Tags  []string          `json:"tags"`
+}
+
+// cloudEvent is a CloudEvent, in the JSON format.
+type cloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Subject         string       `json:"subject,omitempty"`
+	Time            string       `json:"time,omitempty"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            webhookEvent `json:"data"`
+}
+
+// webhook is an eventSink that POSTs batches of events to an endpoint.
+type webhook struct {
+	client    *retryingClient
+	url       string
+	format    string
+	events    map[string][]string
+	headers   headerTemplates
+	secret    []byte
+	host      string
+	interval  time.Duration
+	batchSize int
+
+	// spool is nil when undelivered batches are dropped.
+	spool *spool
+
+	mu sync.Mutex
+	// buffered are the encoded events that haven't been sent.
+	buffered []json.RawMessage
+
+	// full is signalled when batchSize events are buffered.
+	full chan bool
+	done chan bool
+	wg   sync.WaitGroup
+}
+
+// newWebhook returns a webhook, and starts sending events.
+func newWebhook(c WebhookConfig) (*webhook, error) {
+	e := c.HTTPExportConfig.defaults(defaultWebhookFlushInterval, defaultWebhookBatchSize)
+
+	w := &webhook{
+		client:    newRetryingClient(e.MaxRetries),
+		url:       c.URL,
+		format:    c.Format,
+		events:    c.Events,
+		interval:  e.FlushInterval.Duration,
+		batchSize: e.BatchSize,
+		full:      make(chan bool, 1),
+		done:      make(chan bool),
+	}
+	if w.format == "" {
+		w.format = webhookJSON
+	}
+	w.host, _ = os.Hostname()
+
+	headers, err := parseHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	w.headers = headers
+
+	if c.SecretFile != "" || c.SecretEnv != "" {
+		secret, err := readSecret("webhook secret", c.SecretFile, c.SecretEnv)
+		if err != nil {
+			return nil, err
+		}
+		w.secret = []byte(secret)
+	}
+
+	if c.SpoolDir != "" {
+		limit := c.SpoolLimit
+		if limit <= 0 {
+			limit = defaultWebhookSpoolLimit
+		}
+		s, err := newSpool(c.SpoolDir, limit)
+		if err != nil {
+			return nil, err
+		}
+		w.spool = s
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		flushLoop(w.interval, w.full, w.done, w.flush)
+	}()
+	return w, nil
+}
+
+// send buffers the event, if it's selected.
+func (w *webhook) send(event *docker.APIEvents, tags []string) {
+	if !selected(w.events, event) {
+		return
+	}
+
+	// Events are encoded straight away, since they're reused once
+	// they've been reported.
+	raw, err := w.encode(event, tags)
+	if err != nil {
+		log.Printf("error encoding event for webhook %s: %v", w.url, err)
+		return
+	}
+
+	w.mu.Lock()
+	w.buffered = append(w.buffered, raw)
+	full := len(w.buffered) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- true:
+		default:
+		}
+	}
+}
+
+// encode encodes the event in the webhook's format.
+func (w *webhook) encode(event *docker.APIEvents, tags []string) (json.RawMessage, error) {
+	data := webhookEvent{Event: event, Tags: tags}
+	if w.format != webhookCloudEvents {
+		return json.Marshal(data)
+	}
+
+	action, _ := splitAction(event.Action)
+	id := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d", event.Type, event.Action, event.Actor.ID, event.TimeNano)))
+	ce := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id[:]),
+		Source:          "/dockerdog/" + w.host,
+		Type:            fmt.Sprintf("com.docker.%s.%s", event.Type, action),
+		Subject:         event.Actor.ID,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	if event.TimeNano != 0 || event.Time != 0 {
+		ce.Time = eventTime(event).UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(ce)
+}
+
+// Close sends any buffered events.
+func (w *webhook) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	return nil
+}
+
+// flush sends the buffered events in batches. Once a batch can't be sent, it
+// and later batches are spooled, if enabled, or dropped, so that spooled
+// batches are sent in order.
+func (w *webhook) flush() {
+	w.mu.Lock()
+	buffered := w.buffered
+	w.buffered = nil
+	w.mu.Unlock()
+
+	down := false
+	if w.spool != nil {
+		if err := w.spool.resend(w.post); err != nil {
+			log.Printf("error sending spooled events to webhook %s: %v", w.url, err)
+			down = true
+		}
+	}
+
+	for len(buffered) > 0 {
+		n := w.batchSize
+		if n > len(buffered) {
+			n = len(buffered)
+		}
+		body, err := json.Marshal(buffered[:n])
+		buffered = buffered[n:]
+		if err != nil {
+			log.Printf("error encoding events for webhook %s: %v", w.url, err)
+			continue
+		}
+
+		if !down {
+			err = w.post(body)
+			if err == nil {
+				continue
+			}
+			log.Printf("error sending events to webhook %s: %v", w.url, err)
+			down = true
+		}
+		if w.spool != nil {
+			if err := w.spool.write(body); err != nil {
+				log.Printf("error spooling events for webhook %s: %v", w.url, err)
+			}
+		}
+	}
+}
+
+// post posts a batch of events, retrying with backoff.
+func (w *webhook) post(body []byte) error {
+	return w.client.post(w.url, body, func() (http.Header, error) {
+		return w.header(body)
+	})
+}
+
+// header returns the headers for a request with the body.
+func (w *webhook) header(body []byte) (http.Header, error) {
+	h := make(http.Header)
+	if w.format == webhookCloudEvents {
+		h.Set("Content-Type", "application/cloudevents-batch+json")
+	} else {
+		h.Set("Content-Type", "application/json")
+	}
+
+	if err := w.headers.render(h, w.host); err != nil {
+		return nil, err
+	}
+
+	if w.secret != nil {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		h.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return h, nil
+}
+
+// spool keeps request bodies in a directory, one per file, until they can be
+// sent. Files are named so that they sort in the order they were written.
+type spool struct {
+	dir   string
+	limit int
+	seq   int
+}
+
+func newSpool(dir string, limit int) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create spool directory: %v", err)
+	}
+	return &spool{dir: dir, limit: limit}, nil
+}
+
+// write spools the body, and drops the oldest spooled bodies beyond the
+// limit.
+func (s *spool) write(body []byte) error {
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), s.seq%1000000)
+
+	// Bodies are written to a hidden file first, so that partially
+	// written bodies are never sent.
+	tmp := filepath.Join(s.dir, "."+name)
+	if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+
+	names, err := s.names()
+	if err != nil {
+		return err
+	}
+	for len(names) > s.limit {
+		log.Printf("spool %s is full, dropping %s", s.dir, names[0])
+		os.Remove(filepath.Join(s.dir, names[0]))
+		names = names[1:]
+	}
+	return nil
+}
+
+// resend sends the spooled bodies, oldest first, and removes them once
+// they're sent, until one can't be sent.
+func (s *spool) resend(send func([]byte) error) error {
+	names, err := s.names()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := send(body); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// names returns the names of the spooled files, oldest first.
+func (s *spool) names() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+			names = append(names, f.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,259 @@
+package dockerdog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWebhook is a fake webhook endpoint, which records each request.
+type fakeWebhook struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	down     bool
+}
+
+func newFakeWebhook() *fakeWebhook {
+	f := &fakeWebhook{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		f.requests = append(f.requests, r)
+		f.bodies = append(f.bodies, string(body))
+	}))
+	return f
+}
+
+func (f *fakeWebhook) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeWebhook) received() ([]*http.Request, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests, f.bodies
+}
+
+// assertJSON asserts that the JSON documents are equal.
+func assertJSON(t *testing.T, expected, actual string) {
+	var e, a interface{}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(actual), &a); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, e, a)
+}
+
+func newTestWebhook(t *testing.T, c WebhookConfig) *webhook {
+	w, err := newWebhook(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.client.backoff = time.Millisecond
+	return w
+}
+
+var webhookTestEvents = []*docker.APIEvents{
+	{Type: "container", Action: "start", Actor: docker.APIActor{ID: "abc", Attributes: map[string]string{"name": "web"}}, TimeNano: 1500000000000000000},
+	{Type: "container", Action: "die", Actor: docker.APIActor{ID: "abc", Attributes: map[string]string{"name": "web", "exitCode": "1"}}, TimeNano: 1500000001000000000},
+	{Type: "image", Action: "pull", Actor: docker.APIActor{ID: "redis"}, TimeNano: 1500000002000000000},
+}
+
+func TestWebhook(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+
+	os.Setenv("DOCKERDOG_TEST_WEBHOOK_SECRET", "secret")
+	defer os.Unsetenv("DOCKERDOG_TEST_WEBHOOK_SECRET")
+	os.Setenv("DOCKERDOG_TEST_WEBHOOK_TOKEN", "token")
+	defer os.Unsetenv("DOCKERDOG_TEST_WEBHOOK_TOKEN")
+
+	w := newTestWebhook(t, WebhookConfig{
+		URL:       api.URL,
+		Events:    map[string][]string{"container": nil},
+		SecretEnv: "DOCKERDOG_TEST_WEBHOOK_SECRET",
+		HTTPExportConfig: HTTPExportConfig{
+			Headers: map[string]string{"Authorization": `Bearer {{env "DOCKERDOG_TEST_WEBHOOK_TOKEN"}}`},
+		},
+	})
+	for _, event := range webhookTestEvents {
+		w.send(event, []string{"name:web"})
+	}
+	assert.NoError(t, w.Close())
+
+	requests, bodies := api.received()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	assert.Equal(t, "application/json", requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", requests[0].Header.Get("Authorization"))
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(bodies[0]))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), requests[0].Header.Get("X-Dockerdog-Signature"))
+
+	assertJSON(t, `[
+  {"event": {"type": "container", "action": "start", "actor": {"id": "abc", "attributes": {"name": "web"}}, "timeNano": 1500000000000000000}, "tags": ["name:web"]},
+  {"event": {"type": "container", "action": "die", "actor": {"id": "abc", "attributes": {"name": "web", "exitCode": "1"}}, "timeNano": 1500000001000000000}, "tags": ["name:web"]}
+]`, bodies[0])
+}
+
+func TestWebhook_CloudEvents(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+
+	w := newTestWebhook(t, WebhookConfig{
+		URL:    api.URL,
+		Format: "cloudevents",
+		Events: map[string][]string{"container": {"die"}},
+	})
+	w.host = "web-1"
+	for _, event := range webhookTestEvents {
+		w.send(event, nil)
+	}
+	assert.NoError(t, w.Close())
+
+	requests, bodies := api.received()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	assert.Equal(t, "application/cloudevents-batch+json", requests[0].Header.Get("Content-Type"))
+
+	var events []map[string]interface{}
+	if err := json.Unmarshal([]byte(bodies[0]), &events); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "1.0", events[0]["specversion"])
+		assert.Equal(t, "com.docker.container.die", events[0]["type"])
+		assert.Equal(t, "/dockerdog/web-1", events[0]["source"])
+		assert.Equal(t, "abc", events[0]["subject"])
+		assert.Equal(t, "2017-07-14T02:40:01Z", events[0]["time"])
+		assert.Len(t, events[0]["id"], 40)
+	}
+}
+
+func TestWebhook_BatchSize(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+
+	w := newTestWebhook(t, WebhookConfig{URL: api.URL, HTTPExportConfig: HTTPExportConfig{BatchSize: 2}})
+	for _, event := range webhookTestEvents {
+		w.send(event, nil)
+	}
+	assert.NoError(t, w.Close())
+
+	var n int
+	_, bodies := api.received()
+	for _, body := range bodies {
+		var events []interface{}
+		json.Unmarshal([]byte(body), &events)
+		assert.True(t, len(events) <= 2)
+		n += len(events)
+	}
+	assert.Equal(t, 3, n)
+}
+
+func TestWebhook_Spool(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+	api.setDown(true)
+
+	dir, err := ioutil.TempDir("", "dockerdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := newTestWebhook(t, WebhookConfig{URL: api.URL, SpoolDir: dir, SpoolLimit: 2, HTTPExportConfig: HTTPExportConfig{BatchSize: 1, MaxRetries: 1}})
+	for _, event := range webhookTestEvents {
+		w.send(event, nil)
+	}
+	w.flush()
+
+	// Only the newest batches are kept.
+	names, err := w.spool.names()
+	assert.NoError(t, err)
+	assert.Len(t, names, 2)
+
+	api.setDown(false)
+	assert.NoError(t, w.Close())
+
+	_, bodies := api.received()
+	if assert.Len(t, bodies, 2) {
+		assert.Contains(t, bodies[0], `"die"`)
+		assert.Contains(t, bodies[1], `"pull"`)
+	}
+	names, err = w.spool.names()
+	assert.NoError(t, err)
+	assert.Len(t, names, 0)
+}
+
+func TestWebhookConfig_Validate(t *testing.T) {
+	for config, err := range map[string]string{
+		`{"webhooks": [{}]}`: "webhook has no url",
+		`{"webhooks": [{"url": "http://x", "format": "xml"}]}`: `unknown webhook format "xml"`,
+	} {
+		_, lerr := LoadConfig(strings.NewReader(config))
+		assert.EqualError(t, lerr, err, config)
+	}
+
+	_, err := LoadConfig(strings.NewReader(`{"webhooks": [{"url": "http://x", "headers": {"A": "{{"}}]}`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid webhook header A: ")
+	}
+}
+
+func TestReporter_Outputs(t *testing.T) {
+	api := newFakeWebhook()
+	defer api.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+  "attributes": {"name": true},
+  "events": {"container": {}},
+  "webhooks": [{"url": "` + api.URL + `"}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestStatsd(t)
+	defer s.Close()
+
+	w, err := NewWatcher(config, s, WithSource(&ReaderSource{
+		Reader: strings.NewReader(`{"Type": "container", "Action": "die", "Actor": {"ID": "abc", "Attributes": {"name": "web"}}, "timeNano": 1500000000000000000}`),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Run(context.Background()))
+
+	_, bodies := api.received()
+	if assert.Len(t, bodies, 1) {
+		assertJSON(t, `[{"event": {"type": "container", "action": "die", "actor": {"id": "abc", "attributes": {"name": "web"}}, "timeNano": 1500000000000000000}, "tags": ["name:web"]}]`, bodies[0])
+	}
+}